@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// Role is what a user may do with the bot. Higher roles include the lower ones.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "members",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+func parseRole(s string) (Role, error) {
+	for role, name := range roleNames {
+		if name == s {
+			return role, nil
+		}
+	}
+
+	return RoleNone, fmt.Errorf("unknown role %q", s)
+}
+
+// ACL lists the chats and users allowed to use the bot.
+type ACL struct {
+	// Chats maps chat IDs to the role every member of the chat has.
+	// A chat with RoleNone ("members") is allowed, but only its members listed in Users may use the bot there.
+	Chats map[int64]Role
+	// Users maps Telegram user IDs to their role. Users may use the bot in private chats
+	// and in allowed group chats, where the higher of the chat and the user role applies.
+	Users map[int64]Role
+}
+
+// newACL builds an ACL from chat and user IDs mapped to role names.
+func newACL(chats, users map[int64]string) (*ACL, error) {
+	acl := &ACL{Chats: make(map[int64]Role), Users: make(map[int64]Role)}
+
+	var errs []error
+	for _, id := range sortedIDs(chats) {
+		name := chats[id]
+		role, err := parseRole(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %d: %w", id, err))
+		}
+		acl.Chats[id] = role
+	}
+	for _, id := range sortedIDs(users) {
+		name := users[id]
+		role, err := parseRole(name)
+		if err == nil && role == RoleNone {
+			err = fmt.Errorf("role %q only applies to chats", name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %d: %w", id, err))
+		}
+		acl.Users[id] = role
+	}
+
+	return acl, errors.Join(errs...)
+}
+
+func sortedIDs(m map[int64]string) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids
+}
+
+// parseRoleList parses allowlists such as "-1001234567890:viewer,42:members" into IDs mapped to role names.
+func parseRoleList(s string) (map[int64]string, error) {
+	roles := make(map[int64]string)
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		rawID, role, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q: want <id>:<role>", entry)
+		}
+
+		id, err := strconv.ParseInt(strings.TrimSpace(rawID), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid id", entry)
+		}
+
+		roles[id] = strings.TrimSpace(role)
+	}
+
+	return roles, nil
+}
+
+// Role returns the role of a user in a chat. Group chats that are not listed are denied
+// even for listed users, so that GPU details do not leak to their other members.
+func (a *ACL) Role(chat *gotgbot.Chat, user *gotgbot.User) Role {
+	var userRole Role
+	if user != nil {
+		userRole = a.Users[user.Id]
+	}
+
+	if chat == nil {
+		return userRole
+	}
+	if chat.Type == gotgbot.ChatTypePrivate {
+		return max(userRole, a.Chats[chat.Id])
+	}
+
+	chatRole, ok := a.Chats[chat.Id]
+	if !ok {
+		return RoleNone
+	}
+
+	return max(chatRole, userRole)
+}
+
+// AlertChats returns the chats that receive alerts: every chat whose members all may see the GPU state.
+func (a *ACL) AlertChats() []int64 {
+	var chats []int64
+	for id, role := range a.Chats {
+		if role >= RoleViewer {
+			chats = append(chats, id)
+		}
+	}
+	slices.Sort(chats)
+
+	return chats
+}
+
+// roleKey stores the role of the sender in ext.Context.Data.
+const roleKey = "role"
+
+// senderRole returns the role the access middleware granted to the sender of an update.
+func senderRole(ctx *ext.Context) Role {
+	role, _ := ctx.Data[roleKey].(Role)
+	return role
+}
+
+type accessRule struct {
+	handler ext.Handler
+	role    Role
+}
+
+// Access is a dispatcher middleware that checks the role required by every handler
+// registered through it before the handler runs.
+type Access struct {
+	// ACL returns the current ACL, which changes when the configuration is reloaded.
+	ACL   func() *ACL
+	rules []accessRule
+}
+
+// Handle registers h with the dispatcher, restricted to senders with at least the given role.
+func (a *Access) Handle(d *ext.Dispatcher, role Role, h ext.Handler) {
+	a.rules = append(a.rules, accessRule{handler: h, role: role})
+	d.AddHandler(h)
+}
+
+func (a *Access) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	return true
+}
+
+func (a *Access) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	for _, rule := range a.rules {
+		if !rule.handler.CheckUpdate(b, ctx) {
+			continue
+		}
+
+		role := a.ACL().Role(ctx.EffectiveChat, ctx.EffectiveUser)
+		if role >= rule.role {
+			ctx.Data[roleKey] = role
+			return nil
+		}
+
+		if err := denyAccess(b, ctx, rule.role); err != nil {
+			log.Println("failed to send not authorized message:", err.Error())
+		}
+		return ext.EndGroups
+	}
+
+	// Nothing would handle the update anyway.
+	return ext.EndGroups
+}
+
+func (a *Access) Name() string {
+	return "access"
+}
+
+// denyAccess tells the sender that they are not allowed to do what they asked,
+// together with the IDs an admin needs to allow them.
+func denyAccess(b *gotgbot.Bot, ctx *ext.Context, required Role) error {
+	text := fmt.Sprintf("Not authorized: this requires the %s role.", required)
+
+	var ids []string
+	if ctx.EffectiveChat != nil {
+		ids = append(ids, fmt.Sprintf("chat %d", ctx.EffectiveChat.Id))
+	}
+	if ctx.EffectiveUser != nil {
+		ids = append(ids, fmt.Sprintf("user %d", ctx.EffectiveUser.Id))
+	}
+	if len(ids) > 0 {
+		text += " (" + strings.Join(ids, ", ") + ")"
+	}
+
+	if ctx.CallbackQuery != nil {
+		_, err := ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: text, ShowAlert: true})
+		return err
+	}
+	if ctx.EffectiveMessage == nil {
+		return nil
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(b, text, nil)
+	return err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+const (
+	testGroup       = -1001
+	testMembersOnly = -1002
+	testOtherGroup  = -1003
+	testAdmin       = 11
+	testOperator    = 12
+	testStranger    = 13
+)
+
+func testACL(t *testing.T) *ACL {
+	t.Helper()
+
+	chats, err := parseRoleList("-1001:viewer, -1002:members")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := parseRoleList("11:admin,12:operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err := newACL(chats, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return acl
+}
+
+func TestParseACL(t *testing.T) {
+	acl := testACL(t)
+	if acl.Chats[testGroup] != RoleViewer || acl.Chats[testMembersOnly] != RoleNone || len(acl.Chats) != 2 {
+		t.Errorf("chats = %v", acl.Chats)
+	}
+	if acl.Users[testAdmin] != RoleAdmin || acl.Users[testOperator] != RoleOperator || len(acl.Users) != 2 {
+		t.Errorf("users = %v", acl.Users)
+	}
+
+	for _, list := range []string{"-1001", "x:viewer", "-1001:viewer,12"} {
+		if _, err := parseRoleList(list); err == nil {
+			t.Errorf("parseRoleList(%q) succeeded", list)
+		}
+	}
+
+	_, err := newACL(map[int64]string{testGroup: "owner"}, map[int64]string{testAdmin: "members", testOperator: "root"})
+	if err == nil || strings.Count(err.Error(), "\n") != 2 {
+		t.Errorf("newACL() = %v, want three errors", err)
+	}
+}
+
+func TestACLRole(t *testing.T) {
+	acl := testACL(t)
+
+	group := func(id int64) *gotgbot.Chat { return &gotgbot.Chat{Id: id, Type: gotgbot.ChatTypeSupergroup} }
+	private := func(id int64) *gotgbot.Chat { return &gotgbot.Chat{Id: id, Type: gotgbot.ChatTypePrivate} }
+
+	tests := []struct {
+		name string
+		chat *gotgbot.Chat
+		user int64
+		want Role
+	}{
+		{"stranger in group", group(testGroup), testStranger, RoleViewer},
+		{"operator in group", group(testGroup), testOperator, RoleOperator},
+		{"stranger in members only group", group(testMembersOnly), testStranger, RoleNone},
+		{"admin in members only group", group(testMembersOnly), testAdmin, RoleAdmin},
+		{"admin in unlisted group", group(testOtherGroup), testAdmin, RoleNone},
+		{"admin in private chat", private(testAdmin), testAdmin, RoleAdmin},
+		{"stranger in private chat", private(testStranger), testStranger, RoleNone},
+	}
+
+	for _, tt := range tests {
+		if got := acl.Role(tt.chat, &gotgbot.User{Id: tt.user}); got != tt.want {
+			t.Errorf("%s: Role() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestACLAlertChats(t *testing.T) {
+	acl := testACL(t)
+	acl.Chats[testOtherGroup] = RoleOperator
+
+	if got, want := acl.AlertChats(), []int64{testOtherGroup, testGroup}; !slices.Equal(got, want) {
+		t.Errorf("AlertChats() = %v, want %v", got, want)
+	}
+}
+
+func TestAccessHandleUpdate(t *testing.T) {
+	acl := testACL(t)
+	access := &Access{ACL: func() *ACL { return acl }}
+	dispatcher := ext.NewDispatcher(nil)
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("state", nil))
+
+	b := &gotgbot.Bot{User: gotgbot.User{Username: "test_bot"}}
+	update := func(text string) *ext.Context {
+		return ext.NewContext(&gotgbot.Update{Message: &gotgbot.Message{
+			Text:     text,
+			Chat:     gotgbot.Chat{Id: testGroup, Type: gotgbot.ChatTypeSupergroup},
+			From:     &gotgbot.User{Id: testOperator},
+			Entities: []gotgbot.MessageEntity{{Type: "bot_command", Length: int64(len(text))}},
+		}}, nil)
+	}
+
+	ctx := update("/state")
+	if err := access.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("HandleUpdate(/state) = %v", err)
+	}
+	if got := senderRole(ctx); got != RoleOperator {
+		t.Errorf("senderRole() = %s, want operator", got)
+	}
+
+	if err := access.HandleUpdate(b, update("/unknown")); err != ext.EndGroups {
+		t.Errorf("HandleUpdate(/unknown) = %v, want EndGroups", err)
+	}
+}
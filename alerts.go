@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AlertMetric identifies the GPU reading an AlertRule watches.
+type AlertMetric string
+
+const (
+	// MetricTemperature is the GPU temperature in degrees Celsius.
+	MetricTemperature AlertMetric = "temperature"
+	// MetricFanSpeed is the fan speed in percent.
+	MetricFanSpeed AlertMetric = "fan_speed"
+	// MetricMemoryUsed is the used memory in percent of the total memory.
+	MetricMemoryUsed AlertMetric = "memory_used"
+	// MetricPower is the power draw in percent of the current power limit.
+	MetricPower AlertMetric = "power"
+	// MetricUtilization is the GPU utilization in percent.
+	MetricUtilization AlertMetric = "utilization"
+)
+
+// AlertRule fires when a metric rises above Threshold and resolves once it drops below Clear.
+// Keeping Clear under Threshold stops a value that oscillates around the threshold from flapping.
+type AlertRule struct {
+	Metric    AlertMetric
+	Threshold float64
+	Clear     float64
+}
+
+// defaultAlertRules are used when ALERT_RULES is not set.
+var defaultAlertRules = []AlertRule{
+	{Metric: MetricTemperature, Threshold: 90, Clear: 85},
+}
+
+// parseAlertRules parses rules in the form "temperature=90/85,power=98/90",
+// where the first number is the threshold and the second one the clear level.
+// The clear level may be omitted, in which case it equals the threshold.
+func parseAlertRules(s string) ([]AlertRule, error) {
+	var rules []AlertRule
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, levels, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: expected metric=threshold[/clear]", item)
+		}
+
+		metric := AlertMetric(strings.TrimSpace(name))
+		if _, ok := alertMetricUnits[metric]; !ok {
+			return nil, fmt.Errorf("rule %q: unknown metric %q", item, metric)
+		}
+
+		thresholdStr, clearStr, hasClear := strings.Cut(levels, "/")
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(thresholdStr), 64)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid threshold: %w", item, err)
+		}
+
+		clear := threshold
+		if hasClear {
+			clear, err = strconv.ParseFloat(strings.TrimSpace(clearStr), 64)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid clear level: %w", item, err)
+			}
+			if clear > threshold {
+				return nil, fmt.Errorf("rule %q: clear level is above the threshold", item)
+			}
+		}
+
+		rules = append(rules, AlertRule{Metric: metric, Threshold: threshold, Clear: clear})
+	}
+
+	return rules, nil
+}
+
+var alertMetricUnits = map[AlertMetric]string{
+	MetricTemperature: "C",
+	MetricFanSpeed:    "%",
+	MetricMemoryUsed:  "%",
+	MetricPower:       "%",
+	MetricUtilization: "%",
+}
+
+// alertMetricValue returns the value of metric for gpu, or false if the GPU does not report it.
+func alertMetricValue(gpu GPU, metric AlertMetric) (float64, bool) {
+	switch metric {
+	case MetricTemperature:
+		return gpu.Temperature.Value, gpu.Temperature.OK()
+	case MetricFanSpeed:
+		return gpu.FanSpeed.Value, gpu.FanSpeed.OK()
+	case MetricMemoryUsed:
+		return percentOf(gpu.MemoryUsed, gpu.MemoryTotal)
+	case MetricPower:
+		return percentOf(gpu.PowerDraw, gpu.PowerLimit)
+	case MetricUtilization:
+		return gpu.GPUUtil.Value, gpu.GPUUtil.OK()
+	}
+
+	return 0, false
+}
+
+func percentOf(value, total Reading) (float64, bool) {
+	if !value.OK() || !total.OK() || total.Value == 0 {
+		return 0, false
+	}
+
+	return value.Value / total.Value * 100, true
+}
+
+func formatAlertValue(metric AlertMetric, value float64) string {
+	return fmt.Sprintf("%.0f %s", value, alertMetricUnits[metric])
+}
+
+type alertKey struct {
+	GPU    string      `json:"gpu"`
+	Metric AlertMetric `json:"metric"`
+}
+
+// firingAlertsKey is where the store keeps the threshold alerts that are firing, so that a restart
+// neither repeats them nor forgets to resolve them.
+const firingAlertsKey = "firing_alerts"
+
+// ThresholdAlerter evaluates AlertRules against every snapshot and reports
+// when a rule starts firing for a GPU and when it is resolved.
+type ThresholdAlerter struct {
+	Rules []AlertRule
+
+	firing map[alertKey]bool
+	store  *Store
+}
+
+// NewThresholdAlerter creates an alerter that continues with the alerts the store has as firing.
+func NewThresholdAlerter(rules []AlertRule, store *Store) *ThresholdAlerter {
+	a := &ThresholdAlerter{Rules: rules, firing: make(map[alertKey]bool), store: store}
+
+	var firing []alertKey
+	if _, err := store.Load(firingAlertsKey, &firing); err != nil {
+		log.Println("failed to load firing alerts:", err.Error())
+	}
+	for _, key := range firing {
+		// Alerts of rules that were removed would never be resolved.
+		if slices.ContainsFunc(rules, func(r AlertRule) bool { return r.Metric == key.Metric }) {
+			a.firing[key] = true
+		}
+	}
+
+	return a
+}
+
+func (a *ThresholdAlerter) Observe(s *Snapshot) []Alert {
+	var alerts []Alert
+
+	for _, gpu := range s.GPUs {
+		for _, rule := range a.Rules {
+			value, ok := alertMetricValue(gpu, rule.Metric)
+			if !ok {
+				continue
+			}
+
+			key := alertKey{GPU: gpu.UUID, Metric: rule.Metric}
+			switch {
+			case !a.firing[key] && value > rule.Threshold:
+				a.firing[key] = true
+				alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>ALERT</b> %s: %s is <b>%s</b> (threshold %s)",
+					gpuLabel(gpu), rule.Metric, formatAlertValue(rule.Metric, value), formatAlertValue(rule.Metric, rule.Threshold))})
+			case a.firing[key] && value < rule.Clear:
+				delete(a.firing, key)
+				alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>RESOLVED</b> %s: %s is back to <b>%s</b>",
+					gpuLabel(gpu), rule.Metric, formatAlertValue(rule.Metric, value))})
+			}
+		}
+	}
+
+	if len(alerts) > 0 {
+		a.save()
+	}
+
+	return alerts
+}
+
+func (a *ThresholdAlerter) save() {
+	firing := make([]alertKey, 0, len(a.firing))
+	for key := range a.firing {
+		firing = append(firing, key)
+	}
+	slices.SortFunc(firing, func(x, y alertKey) int {
+		return strings.Compare(x.GPU+"/"+string(x.Metric), y.GPU+"/"+string(y.Metric))
+	})
+
+	if err := a.store.Save(firingAlertsKey, firing); err != nil {
+		log.Println("failed to save firing alerts:", err.Error())
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAlertRules(t *testing.T) {
+	rules, err := parseAlertRules("temperature=90/85, power=98,memory_used=95/90")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AlertRule{
+		{Metric: MetricTemperature, Threshold: 90, Clear: 85},
+		{Metric: MetricPower, Threshold: 98, Clear: 98},
+		{Metric: MetricMemoryUsed, Threshold: 95, Clear: 90},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+
+	for _, invalid := range []string{"temperature", "voltage=1", "temperature=hot", "temperature=80/90"} {
+		if _, err := parseAlertRules(invalid); err == nil {
+			t.Errorf("parseAlertRules(%q): expected an error", invalid)
+		}
+	}
+}
+
+func TestThresholdAlerterHysteresis(t *testing.T) {
+	s := loadFixture(t, "555")
+	alerter := NewThresholdAlerter([]AlertRule{{Metric: MetricTemperature, Threshold: 90, Clear: 85}}, nil)
+
+	observe := func(temperature float64) []Alert {
+		s.GPUs[0].Temperature.Value = temperature
+		s.GPUs[1].Temperature.Value = 40
+		return alerter.Observe(s)
+	}
+
+	alerts := observe(93)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "ALERT") || !strings.Contains(alerts[0].Text, "93 C") {
+		t.Fatalf("expected a firing alert, got %v", alerts)
+	}
+
+	for _, temperature := range []float64{95, 89, 91, 86} {
+		if alerts := observe(temperature); len(alerts) != 0 {
+			t.Fatalf("temperature %v: expected no alerts while firing, got %v", temperature, alerts)
+		}
+	}
+
+	alerts = observe(84)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "RESOLVED") {
+		t.Fatalf("expected a resolved alert, got %v", alerts)
+	}
+
+	if alerts := observe(88); len(alerts) != 0 {
+		t.Fatalf("expected no alerts below the threshold, got %v", alerts)
+	}
+}
+
+func TestAlertMetricValue(t *testing.T) {
+	gpu := loadFixture(t, "555").GPUs[0]
+
+	tests := []struct {
+		metric AlertMetric
+		want   float64
+	}{
+		{MetricTemperature, 93},
+		{MetricFanSpeed, 88},
+		{MetricUtilization, 39},
+		{MetricPower, 124.19 / 140 * 100},
+		{MetricMemoryUsed, 14551.0 / 16376 * 100},
+	}
+	for _, tt := range tests {
+		got, ok := alertMetricValue(gpu, tt.metric)
+		if !ok || got != tt.want {
+			t.Errorf("alertMetricValue(%s) = %v, %v, want %v", tt.metric, got, ok, tt.want)
+		}
+	}
+
+	gpu = loadFixture(t, "470").GPUs[0]
+	if _, ok := alertMetricValue(gpu, MetricFanSpeed); ok {
+		t.Error("expected no fan speed for a passively cooled GPU")
+	}
+}
+
+func TestThresholdAlerterSurvivesRestart(t *testing.T) {
+	s := loadFixture(t, "555")
+	store := testStore(t)
+	rules := []AlertRule{{Metric: MetricTemperature, Threshold: 90, Clear: 85}}
+
+	s.GPUs[0].Temperature.Value = 93
+	s.GPUs[1].Temperature.Value = 40
+	if alerts := NewThresholdAlerter(rules, store).Observe(s); len(alerts) != 1 {
+		t.Fatalf("expected a firing alert, got %v", alerts)
+	}
+
+	// After a restart the alert is neither repeated nor forgotten.
+	restarted := NewThresholdAlerter(rules, store)
+	if alerts := restarted.Observe(s); len(alerts) != 0 {
+		t.Fatalf("firing alert repeated after a restart: %v", alerts)
+	}
+	s.GPUs[0].Temperature.Value = 80
+	if alerts := restarted.Observe(s); len(alerts) != 1 || !strings.Contains(alerts[0].Text, "RESOLVED") {
+		t.Fatalf("expected a resolved alert after a restart, got %v", alerts)
+	}
+
+	// Alerts of removed rules are dropped.
+	s.GPUs[0].Temperature.Value = 93
+	NewThresholdAlerter(rules, store).Observe(s)
+	if a := NewThresholdAlerter([]AlertRule{{Metric: MetricPower, Threshold: 98, Clear: 90}}, store); len(a.firing) != 0 {
+		t.Errorf("firing = %v", a.firing)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+type chartPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// lineChart is a time series plotted from From to To.
+type lineChart struct {
+	Points   []chartPoint
+	From, To time.Time
+	Unit     string
+	// Max fixes the top of the value axis, such as 100 for percentages. Zero scales it to the points.
+	Max float64
+	// Gap is the longest time between two points that are still joined by a line.
+	Gap time.Duration
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 400
+
+	chartLeft   = 56
+	chartRight  = chartWidth - 20
+	chartTop    = 24
+	chartBottom = chartHeight - 28
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	chartAxis       = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	chartText       = color.RGBA{0x30, 0x30, 0x30, 0xff}
+	chartLine       = color.RGBA{0x1f, 0x77, 0xb4, 0xff}
+)
+
+// xTickSteps are the spacings of the time axis labels, from the finest to the coarsest.
+var xTickSteps = []time.Duration{
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 2 * 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// renderChart draws the chart as a PNG image.
+func renderChart(c lineChart) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(chartBackground), image.Point{}, draw.Src)
+
+	top := c.Max
+	if top == 0 {
+		for _, p := range c.Points {
+			top = math.Max(top, p.Value)
+		}
+		top = niceCeil(top * 1.1)
+	}
+	span := c.To.Sub(c.From)
+	if span <= 0 {
+		span = time.Second
+	}
+
+	x := func(t time.Time) int {
+		return chartLeft + int(float64(t.Sub(c.From))/float64(span)*(chartRight-chartLeft))
+	}
+	y := func(v float64) int {
+		return chartBottom - int(v/top*(chartBottom-chartTop))
+	}
+
+	const yTicks = 5
+	for i := 0; i <= yTicks; i++ {
+		value := top * float64(i) / yTicks
+		row := y(value)
+		horizontalLine(img, chartLeft, chartRight, row, chartGrid)
+		label := fmt.Sprintf("%.0f", value)
+		if top < 10 {
+			label = fmt.Sprintf("%.1f", value)
+		}
+		drawText(img, label, chartLeft-6-textWidth(label), row+4, true)
+	}
+
+	tick := xTickSteps[len(xTickSteps)-1]
+	for _, step := range xTickSteps {
+		if span/step <= 8 {
+			tick = step
+			break
+		}
+	}
+	layout := "15:04"
+	if tick >= 24*time.Hour {
+		layout = "Jan 2"
+	}
+	for t := alignTick(c.From, tick); !t.After(c.To); t = alignTick(t.Add(tick), tick) {
+		column := x(t)
+		verticalLine(img, column, chartTop, chartBottom, chartGrid)
+		label := t.Format(layout)
+		drawText(img, label, column-textWidth(label)/2, chartBottom+18, true)
+	}
+
+	horizontalLine(img, chartLeft, chartRight, chartBottom, chartAxis)
+	verticalLine(img, chartLeft, chartTop, chartBottom, chartAxis)
+	drawText(img, c.Unit, chartLeft-6-textWidth(c.Unit), chartTop-10, false)
+
+	for i, p := range c.Points {
+		if i > 0 && (c.Gap == 0 || p.Time.Sub(c.Points[i-1].Time) <= c.Gap) {
+			previous := c.Points[i-1]
+			drawLine(img, x(previous.Time), y(previous.Value), x(p.Time), y(p.Value))
+		} else {
+			drawLine(img, x(p.Time), y(p.Value), x(p.Time), y(p.Value))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// niceCeil rounds v up to 1, 2, 2.5 or 5 times a power of ten.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*magnitude >= v {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// alignTick returns the first multiple of step in local time at or after t.
+func alignTick(t time.Time, step time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	aligned := t.Add(shift).Truncate(step).Add(-shift)
+	if aligned.Before(t) {
+		aligned = aligned.Add(step)
+	}
+	return aligned
+}
+
+func horizontalLine(img *image.RGBA, x0, x1, y int, c color.Color) {
+	for x := x0; x <= x1; x++ {
+		img.Set(x, y, c)
+	}
+}
+
+func verticalLine(img *image.RGBA, x, y0, y1 int, c color.Color) {
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, c)
+	}
+}
+
+// drawLine draws a two pixel wide line with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	err := dx + dy
+	for {
+		img.Set(x0, y0, chartLine)
+		img.Set(x0+1, y0, chartLine)
+		img.Set(x0, y0+1, chartLine)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e := 2 * err
+		if e >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func textWidth(s string) int {
+	return font.MeasureString(basicfont.Face7x13, s).Ceil()
+}
+
+// drawText draws s with its baseline at y, skipping labels that would not fit when clip is set.
+func drawText(img *image.RGBA, s string, x, y int, clip bool) {
+	if clip && (x < 0 || x+textWidth(s) > chartWidth) {
+		return
+	}
+
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(chartText),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
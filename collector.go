@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Collector is a source of GPU state snapshots.
+type Collector interface {
+	Collect(ctx context.Context) (*Snapshot, error)
+}
+
+// Snapshot is the GPU state reported by a Collector at a point in time.
+type Snapshot struct {
+	// Log is the raw nvidia-smi report.
+	Log *NvidiaSmiLog
+	// GPUs is the normalized view of Log.Gpu, in the same order.
+	GPUs        []GPU
+	CollectedAt time.Time
+}
+
+func NewSnapshot(log *NvidiaSmiLog, collectedAt time.Time) *Snapshot {
+	s := &Snapshot{Log: log, CollectedAt: collectedAt}
+	for i := range log.Gpu {
+		s.GPUs = append(s.GPUs, newGPU(i, &log.Gpu[i]))
+	}
+
+	return s
+}
+
+// SwitchCollector forwards to a collector that can be replaced while the bot is running.
+type SwitchCollector struct {
+	current atomic.Pointer[Collector]
+}
+
+func NewSwitchCollector(c Collector) *SwitchCollector {
+	s := &SwitchCollector{}
+	s.Set(c)
+	return s
+}
+
+// Set replaces the collector used by the following calls to Collect.
+func (s *SwitchCollector) Set(c Collector) {
+	s.current.Store(&c)
+}
+
+func (s *SwitchCollector) Collect(ctx context.Context) (*Snapshot, error) {
+	return (*s.current.Load()).Collect(ctx)
+}
+
+// CachedCollector shares snapshots younger than its max age between its callers, so that
+// Telegram commands, alerts and Prometheus scrapes do not each run nvidia-smi.
+// At most one collection runs at a time: concurrent callers wait for the one in flight and share its result.
+type CachedCollector struct {
+	collector Collector
+
+	mu       sync.Mutex
+	maxAge   time.Duration
+	snapshot *Snapshot
+	flight   *collection
+}
+
+// collection is a run of the underlying collector that callers wait for.
+type collection struct {
+	done     chan struct{}
+	snapshot *Snapshot
+	err      error
+}
+
+func NewCachedCollector(c Collector, maxAge time.Duration) *CachedCollector {
+	return &CachedCollector{collector: c, maxAge: maxAge}
+}
+
+// SetMaxAge changes how long snapshots are reused.
+func (c *CachedCollector) SetMaxAge(maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxAge = maxAge
+}
+
+// Forget drops the cached snapshot, e.g. after the underlying collector was replaced.
+func (c *CachedCollector) Forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.snapshot = nil
+}
+
+// Collect returns the cached snapshot if it is fresh enough and otherwise waits for a new one.
+// A caller that gives up through ctx does not cancel the collection the other callers wait for.
+func (c *CachedCollector) Collect(ctx context.Context) (*Snapshot, error) {
+	c.mu.Lock()
+	if c.snapshot != nil && time.Since(c.snapshot.CollectedAt) < c.maxAge {
+		snapshot := c.snapshot
+		c.mu.Unlock()
+		return snapshot, nil
+	}
+
+	flight := c.flight
+	if flight == nil {
+		flight = &collection{done: make(chan struct{})}
+		c.flight = flight
+		go c.run(flight)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-flight.done:
+		return flight.snapshot, flight.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *CachedCollector) run(flight *collection) {
+	flight.snapshot, flight.err = c.collector.Collect(context.Background())
+
+	c.mu.Lock()
+	c.flight = nil
+	if flight.err == nil {
+		c.snapshot = flight.snapshot
+	}
+	c.mu.Unlock()
+
+	close(flight.done)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingCollector counts its collections and takes a while to answer.
+type countingCollector struct {
+	calls atomic.Int32
+	delay time.Duration
+}
+
+func (c *countingCollector) Collect(ctx context.Context) (*Snapshot, error) {
+	c.calls.Add(1)
+	time.Sleep(c.delay)
+	return &Snapshot{CollectedAt: time.Now()}, nil
+}
+
+func TestCachedCollectorSharesSnapshots(t *testing.T) {
+	source := &countingCollector{delay: 20 * time.Millisecond}
+	cached := NewCachedCollector(source, time.Minute)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cached.Collect(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := source.calls.Load(); calls != 1 {
+		t.Errorf("concurrent calls ran the collector %d times, want 1", calls)
+	}
+}
+
+func TestCachedCollectorExpires(t *testing.T) {
+	source := &countingCollector{}
+	cached := NewCachedCollector(source, 10*time.Millisecond)
+
+	first, _ := cached.Collect(context.Background())
+	second, _ := cached.Collect(context.Background())
+	if first != second {
+		t.Error("a fresh snapshot was not reused")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if third, _ := cached.Collect(context.Background()); third == first || source.calls.Load() != 2 {
+		t.Errorf("an expired snapshot was reused, %d calls", source.calls.Load())
+	}
+}
+
+func TestCachedCollectorWaiterGivesUp(t *testing.T) {
+	source := &countingCollector{delay: 50 * time.Millisecond}
+	cached := NewCachedCollector(source, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := cached.Collect(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Collect() = %v, want the context error", err)
+	}
+
+	// The collection the impatient caller started still completes for everyone else.
+	if _, err := cached.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls := source.calls.Load(); calls != 1 {
+		t.Errorf("the collector ran %d times, want 1", calls)
+	}
+}
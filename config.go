@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the YAML configuration file. Durations are Go durations such as "30s".
+type Config struct {
+	// Token is the bot token. The TOKEN environment variable takes precedence, to keep it out of the file.
+	Token string `yaml:"token"`
+	// StateDir is where the bot keeps what must survive a restart.
+	StateDir string `yaml:"state_dir"`
+
+	Access struct {
+		// Chats and Users map IDs to role names, see ACL.
+		Chats map[int64]string `yaml:"chats"`
+		Users map[int64]string `yaml:"users"`
+		// UnixUsers maps Telegram user IDs to the Unix users that run their GPU processes.
+		UnixUsers map[int64]string `yaml:"unix_users"`
+	} `yaml:"access"`
+
+	Alerts struct {
+		Interval string `yaml:"interval"`
+		// Rules are "metric=threshold/clear" rules. Leaving them out keeps the defaults, an empty list turns alerts off.
+		Rules []string `yaml:"rules"`
+		// Throttle is how long a busy GPU may be thermally or power throttled before an alert; 0s turns it off.
+		Throttle string `yaml:"throttle"`
+		// ThrottleIgnorePowerCap does not count the software power cap as throttling.
+		ThrottleIgnorePowerCap bool `yaml:"throttle_ignore_power_cap"`
+	} `yaml:"alerts"`
+
+	Polling struct {
+		// Timeout is the long polling timeout of getUpdates.
+		Timeout string `yaml:"timeout"`
+		// RequestTimeout is the HTTP timeout of getUpdates and must exceed Timeout.
+		RequestTimeout string `yaml:"request_timeout"`
+	} `yaml:"polling"`
+
+	Output struct {
+		// State is what /state without arguments shows: "summary" or "full".
+		State string `yaml:"state"`
+	} `yaml:"output"`
+
+	Metrics struct {
+		// Listen is the address of the Prometheus /metrics listener, e.g. ":9835". It is off when empty.
+		Listen string `yaml:"listen"`
+		// Host is the host label of every metric, the host name by default.
+		Host string `yaml:"host"`
+	} `yaml:"metrics"`
+
+	Collector struct {
+		// NvidiaSmi is the nvidia-smi binary, looked up in PATH by default.
+		NvidiaSmi string `yaml:"nvidia_smi"`
+		// Fixtures replays recorded nvidia-smi output instead of running nvidia-smi.
+		Fixtures string `yaml:"fixtures"`
+		// Timeout limits a run of nvidia-smi; a hung driver otherwise blocks it forever.
+		Timeout string `yaml:"timeout"`
+		// MaxAge is how long a snapshot is shared between commands, alerts and scrapes; 0 always collects.
+		MaxAge string `yaml:"max_age"`
+	} `yaml:"collector"`
+
+	History struct {
+		// Raw is how long every sample of the poller is kept.
+		Raw string `yaml:"raw"`
+		// Downsample keeps averages over Step for Keep, from the finest to the coarsest step.
+		// Leaving it out keeps the defaults, an empty list keeps only the raw samples.
+		Downsample []struct {
+			Step string `yaml:"step"`
+			Keep string `yaml:"keep"`
+		} `yaml:"downsample"`
+	} `yaml:"history"`
+
+	Idle struct {
+		// Window is how long a GPU must hold memory while idle before its users are notified, "0s" turns it off.
+		Window string `yaml:"window"`
+		// MinMemory is the memory a GPU must hold to count as allocated, such as "1 GiB".
+		MinMemory string `yaml:"min_memory"`
+		// Allow lists the users and processes that may hold idle GPUs, such as inference servers.
+		Allow struct {
+			Users     []string `yaml:"users"`
+			Processes []string `yaml:"processes"`
+		} `yaml:"allow"`
+	} `yaml:"idle"`
+
+	PCIe struct {
+		// MaxReplaysPerHour is how fast the PCIe replay counter of a GPU may grow before an alert; 0 turns it off.
+		MaxReplaysPerHour *float64 `yaml:"max_replays_per_hour"`
+	} `yaml:"pcie"`
+
+	Xid struct {
+		// Source is the kernel log to follow for Xid errors: a file such as /var/log/kern.log, or "journal"
+		// for journalctl. Leaving it out turns the watcher off.
+		Source string `yaml:"source"`
+	} `yaml:"xid"`
+
+	Notify struct {
+		// Expiry is how long a /notify_free request waits for a free GPU.
+		Expiry string `yaml:"expiry"`
+	} `yaml:"notify"`
+
+	// Reports are sent to the alert chats on a schedule.
+	Reports []struct {
+		// Schedule is a cron expression in the local time zone, such as "0 9 * * *".
+		Schedule string `yaml:"schedule"`
+		// Range is how far back the report looks, "24h" by default; days and weeks such as "7d" work too.
+		Range string `yaml:"range"`
+	} `yaml:"reports"`
+}
+
+// Settings is a validated configuration.
+type Settings struct {
+	Token    string
+	StateDir string
+	ACL      *ACL
+	// UnixUsers maps Telegram user IDs to Unix users.
+	UnixUsers map[int64]string
+
+	AlertInterval time.Duration
+	AlertRules    []AlertRule
+	// ThrottleDuration is how long a busy GPU may be throttled before an alert.
+	ThrottleDuration       time.Duration
+	ThrottleIgnorePowerCap bool
+
+	PollingTimeout        time.Duration
+	PollingRequestTimeout time.Duration
+
+	// FullState makes /state show the detailed state by default.
+	FullState bool
+
+	MetricsListen string
+	MetricsHost   string
+
+	NvidiaSmi        string
+	NvidiaSmiTimeout time.Duration
+	Fixtures         string
+	SnapshotMaxAge   time.Duration
+
+	// HistoryTiers start with the raw samples, followed by the downsampled tiers.
+	HistoryTiers []HistoryTier
+
+	Reports []ReportSchedule
+
+	FreeWatchExpiry time.Duration
+
+	XidSource string
+
+	MaxReplaysPerHour float64
+
+	IdleWindow         time.Duration
+	IdleMinMemory      float64
+	IdleAllowUsers     []string
+	IdleAllowProcesses []string
+}
+
+// defaultSnapshotMaxAge is how long a snapshot is reused before nvidia-smi runs again.
+const defaultSnapshotMaxAge = 5 * time.Second
+
+// loadConfig loads the configuration file at path or, if path is empty, the environment variables
+// the bot was configured with before it had a configuration file. It reports every problem it finds at once.
+func loadConfig(path string) (*Settings, error) {
+	var config Config
+	var errs []error
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil {
+			var typeErr *yaml.TypeError
+			if !errors.As(err, &typeErr) {
+				return nil, fmt.Errorf("failed to parse config: %w", err)
+			}
+			for _, e := range typeErr.Errors {
+				errs = append(errs, errors.New(e))
+			}
+		}
+	} else {
+		errs = append(errs, config.fromEnv()...)
+	}
+
+	if token := os.Getenv("TOKEN"); token != "" {
+		config.Token = token
+	}
+
+	settings, err := config.settings()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return settings, nil
+}
+
+// fromEnv fills the configuration from CHAT_ID, ACL_CHATS, ACL_USERS, ALERT_RULES, ALERT_INTERVAL,
+// NVIDIA_SMI_FIXTURES, NVIDIA_SMI_TIMEOUT, SNAPSHOT_MAX_AGE, METRICS_LISTEN, METRICS_HOST and STATE_DIR.
+func (c *Config) fromEnv() []error {
+	var errs []error
+
+	var err error
+	if c.Access.Chats, err = parseRoleList(os.Getenv("ACL_CHATS")); err != nil {
+		errs = append(errs, fmt.Errorf("ACL_CHATS: %w", err))
+	}
+	if c.Access.Users, err = parseRoleList(os.Getenv("ACL_USERS")); err != nil {
+		errs = append(errs, fmt.Errorf("ACL_USERS: %w", err))
+	}
+
+	// CHAT_ID is the single chat the bot was limited to before the ACL existed.
+	if envChatID := os.Getenv("CHAT_ID"); envChatID != "" {
+		chatID, err := strconv.ParseInt(envChatID, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CHAT_ID: %w", err))
+		} else if _, ok := c.Access.Chats[chatID]; !ok && c.Access.Chats != nil {
+			c.Access.Chats[chatID] = RoleOperator.String()
+		}
+	}
+
+	if rules, ok := os.LookupEnv("ALERT_RULES"); ok {
+		c.Alerts.Rules = []string{}
+		if rules != "" {
+			c.Alerts.Rules = append(c.Alerts.Rules, rules)
+		}
+	}
+	c.Alerts.Interval = os.Getenv("ALERT_INTERVAL")
+	c.Collector.Fixtures = os.Getenv("NVIDIA_SMI_FIXTURES")
+	c.Collector.MaxAge = os.Getenv("SNAPSHOT_MAX_AGE")
+	c.Collector.Timeout = os.Getenv("NVIDIA_SMI_TIMEOUT")
+	c.Metrics.Listen = os.Getenv("METRICS_LISTEN")
+	c.Metrics.Host = os.Getenv("METRICS_HOST")
+
+	c.StateDir = os.Getenv("STATE_DIR")
+
+	return errs
+}
+
+// settings validates the configuration and fills in the defaults.
+func (c *Config) settings() (*Settings, error) {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", field, err))
+	}
+
+	s := &Settings{
+		Token:         c.Token,
+		StateDir:      c.StateDir,
+		MetricsListen: c.Metrics.Listen,
+		MetricsHost:   c.Metrics.Host,
+		NvidiaSmi:     c.Collector.NvidiaSmi,
+		Fixtures:      c.Collector.Fixtures,
+		UnixUsers:     c.Access.UnixUsers,
+
+		IdleAllowUsers:     c.Idle.Allow.Users,
+		IdleAllowProcesses: c.Idle.Allow.Processes,
+	}
+	if s.Token == "" {
+		fail("token", errors.New("not set, set it in the config or in TOKEN"))
+	}
+	// systemd sets STATE_DIRECTORY when the unit has StateDirectory= configured.
+	if s.StateDir == "" {
+		s.StateDir = os.Getenv("STATE_DIRECTORY")
+	}
+	if s.StateDir == "" {
+		s.StateDir = "."
+	}
+	if s.NvidiaSmi == "" {
+		s.NvidiaSmi = "nvidia-smi"
+	}
+	if s.MetricsHost == "" {
+		s.MetricsHost, _ = os.Hostname()
+	}
+	if s.MetricsListen != "" {
+		if _, _, err := net.SplitHostPort(s.MetricsListen); err != nil {
+			fail("metrics.listen", err)
+		}
+	}
+
+	var err error
+	if s.ACL, err = newACL(c.Access.Chats, c.Access.Users); err != nil {
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			fail("access", err)
+		}
+	}
+	if len(s.ACL.Chats) == 0 && len(s.ACL.Users) == 0 {
+		fail("access", errors.New("no chat or user is allowed"))
+	}
+
+	s.AlertRules = defaultAlertRules
+	if c.Alerts.Rules != nil {
+		s.AlertRules = nil
+		for i, rule := range c.Alerts.Rules {
+			rules, err := parseAlertRules(rule)
+			if err != nil {
+				fail(fmt.Sprintf("alerts.rules[%d]", i), err)
+			}
+			s.AlertRules = append(s.AlertRules, rules...)
+		}
+	}
+
+	s.ThrottleIgnorePowerCap = c.Alerts.ThrottleIgnorePowerCap
+
+	durations := []struct {
+		field     string
+		raw       string
+		value     *time.Duration
+		preset    time.Duration
+		allowZero bool
+	}{
+		{"alerts.interval", c.Alerts.Interval, &s.AlertInterval, 30 * time.Second, false},
+		{"alerts.throttle", c.Alerts.Throttle, &s.ThrottleDuration, defaultThrottleDuration, true},
+		{"polling.timeout", c.Polling.Timeout, &s.PollingTimeout, 9 * time.Second, false},
+		{"polling.request_timeout", c.Polling.RequestTimeout, &s.PollingRequestTimeout, 10 * time.Second, false},
+		{"collector.timeout", c.Collector.Timeout, &s.NvidiaSmiTimeout, defaultNvidiaSmiTimeout, false},
+		{"collector.max_age", c.Collector.MaxAge, &s.SnapshotMaxAge, defaultSnapshotMaxAge, true},
+		{"idle.window", c.Idle.Window, &s.IdleWindow, defaultIdleWindow, true},
+		{"notify.expiry", c.Notify.Expiry, &s.FreeWatchExpiry, defaultFreeWatchExpiry, false},
+	}
+	for _, d := range durations {
+		*d.value = d.preset
+		if d.raw == "" {
+			continue
+		}
+
+		value, err := time.ParseDuration(d.raw)
+		if err == nil && (value < 0 || value == 0 && !d.allowZero) {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fail(d.field, err)
+			continue
+		}
+		*d.value = value
+	}
+	if s.PollingRequestTimeout <= s.PollingTimeout {
+		fail("polling.request_timeout", errors.New("must be longer than polling.timeout"))
+	}
+
+	s.HistoryTiers = c.historyTiers(fail)
+
+	s.IdleMinMemory = defaultIdleMinMemory
+	if c.Idle.MinMemory != "" {
+		r, err := parseReading(c.Idle.MinMemory, UnitBytes)
+		if err == nil && !r.OK() {
+			err = errors.New("not a size")
+		}
+		if err != nil {
+			fail("idle.min_memory", fmt.Errorf("%w, want a size such as \"1 GiB\"", err))
+		}
+		s.IdleMinMemory = r.Value
+	}
+
+	for i, r := range c.Reports {
+		field := fmt.Sprintf("reports[%d]", i)
+		schedule := ReportSchedule{Spec: r.Schedule, RangeText: r.Range}
+		if schedule.RangeText == "" {
+			schedule.RangeText = "24h"
+		}
+
+		var err error
+		if schedule.Schedule, err = parseCron(r.Schedule); err == nil {
+			_, err = schedule.Schedule.Next(time.Now())
+		}
+		if err != nil {
+			fail(field+".schedule", err)
+		}
+		if schedule.Range, err = parseHistoryRange(schedule.RangeText); err != nil {
+			fail(field+".range", err)
+		}
+		s.Reports = append(s.Reports, schedule)
+	}
+
+	s.MaxReplaysPerHour = defaultMaxReplaysPerHour
+	if c.PCIe.MaxReplaysPerHour != nil {
+		s.MaxReplaysPerHour = *c.PCIe.MaxReplaysPerHour
+		if s.MaxReplaysPerHour < 0 {
+			fail("pcie.max_replays_per_hour", errors.New("must not be negative"))
+		}
+	}
+
+	s.XidSource = c.Xid.Source
+	if s.XidSource != "" && s.XidSource != xidJournal && !filepath.IsAbs(s.XidSource) {
+		fail("xid.source", fmt.Errorf("%q is neither an absolute path nor %q", s.XidSource, xidJournal))
+	}
+
+	switch c.Output.State {
+	case "", "summary":
+	case "full":
+		s.FullState = true
+	default:
+		fail("output.state", fmt.Errorf("unknown format %q, want summary or full", c.Output.State))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return s, nil
+}
+
+// historyTiers validates the history section, falling back to defaultHistoryTiers for what is left out.
+func (c *Config) historyTiers(fail func(field string, err error)) []HistoryTier {
+	parse := func(field, raw string, preset time.Duration) time.Duration {
+		if raw == "" {
+			if preset == 0 {
+				fail(field, errors.New("not set"))
+			}
+			return preset
+		}
+		value, err := time.ParseDuration(raw)
+		if err == nil && value <= 0 {
+			err = errors.New("must be positive")
+		}
+		if err != nil {
+			fail(field, err)
+			return preset
+		}
+		return value
+	}
+
+	tiers := []HistoryTier{{Keep: parse("history.raw", c.History.Raw, defaultHistoryTiers[0].Keep)}}
+	if c.History.Downsample == nil {
+		return append(tiers, defaultHistoryTiers[1:]...)
+	}
+
+	for i, d := range c.History.Downsample {
+		field := fmt.Sprintf("history.downsample[%d]", i)
+		tier := HistoryTier{Step: parse(field+".step", d.Step, 0), Keep: parse(field+".keep", d.Keep, 0)}
+		previous := tiers[len(tiers)-1]
+		if tier.Step != 0 && tier.Step <= previous.Step {
+			fail(field+".step", errors.New("must be longer than the previous step"))
+		}
+		if tier.Keep != 0 && tier.Keep <= previous.Keep {
+			fail(field+".keep", errors.New("must be longer than the previous tier keeps samples"))
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return tiers
+}
+
+// newCollector creates the collector the settings ask for.
+func newCollector(s *Settings) (Collector, error) {
+	if s.Fixtures != "" {
+		return NewFixtureCollector(s.Fixtures)
+	}
+
+	return &NvidiaSmiCollector{Binary: s.NvidiaSmi, Timeout: s.NvidiaSmiTimeout}, nil
+}
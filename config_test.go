@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigExample(t *testing.T) {
+	t.Setenv("TOKEN", "123:abc")
+
+	s, err := loadConfig("config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Token != "123:abc" || s.StateDir != "/var/lib/gpu-state-tgbot" || s.FullState {
+		t.Errorf("settings = %+v", s)
+	}
+	if s.ACL.Chats[-1009876543210] != RoleNone || s.ACL.Users[123456789] != RoleAdmin {
+		t.Errorf("acl = %+v", s.ACL)
+	}
+	want := []AlertRule{{MetricTemperature, 90, 85}, {MetricPower, 98, 90}}
+	if !slices.Equal(s.AlertRules, want) || s.AlertInterval != 30*time.Second {
+		t.Errorf("alerts = %v every %s", s.AlertRules, s.AlertInterval)
+	}
+	if s.PollingTimeout != 9*time.Second || s.PollingRequestTimeout != 10*time.Second {
+		t.Errorf("polling = %s, %s", s.PollingTimeout, s.PollingRequestTimeout)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("TOKEN", "")
+	t.Setenv("STATE_DIRECTORY", "")
+
+	s, err := loadConfig(writeConfig(t, "token: abc\naccess:\n  users:\n    1: admin\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.StateDir != "." || s.NvidiaSmi != "nvidia-smi" || !slices.Equal(s.AlertRules, defaultAlertRules) || s.AlertInterval != 30*time.Second {
+		t.Errorf("settings = %+v", s)
+	}
+
+	s, err = loadConfig(writeConfig(t, "token: abc\naccess:\n  users:\n    1: admin\nalerts:\n  rules: []\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.AlertRules) != 0 {
+		t.Errorf("empty rules = %v, want alerts off", s.AlertRules)
+	}
+}
+
+func TestLoadConfigReportsEveryError(t *testing.T) {
+	t.Setenv("TOKEN", "")
+
+	_, err := loadConfig(writeConfig(t, `
+access:
+  chats:
+    -100: owner
+alerts:
+  interval: soon
+  rules:
+    - temperature=90/95
+    - voltage=5
+polling:
+  timeout: 20s
+output:
+  state: verbose
+idle:
+  min_memory: lots
+pcie:
+  max_replays_per_hour: -1
+xid:
+  source: kern.log
+unknown: true
+`))
+	if err == nil {
+		t.Fatal("loadConfig() succeeded")
+	}
+
+	for _, want := range []string{
+		"field unknown not found",
+		"token: not set",
+		"access: chat -100",
+		"alerts.rules[0]",
+		"alerts.rules[1]",
+		"alerts.interval",
+		"polling.request_timeout",
+		"output.state",
+		"idle.min_memory",
+		"pcie.max_replays_per_hour",
+		"xid.source",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%s", want, err)
+		}
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("TOKEN", "abc")
+	t.Setenv("CHAT_ID", "-100")
+	t.Setenv("ACL_CHATS", "-200:viewer")
+	t.Setenv("ACL_USERS", "1:admin")
+	t.Setenv("ALERT_RULES", "")
+	t.Setenv("ALERT_INTERVAL", "1m")
+	t.Setenv("STATE_DIR", "/tmp/state")
+
+	s, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.ACL.Chats[-100] != RoleOperator || s.ACL.Chats[-200] != RoleViewer || s.ACL.Users[1] != RoleAdmin {
+		t.Errorf("acl = %+v", s.ACL)
+	}
+	if len(s.AlertRules) != 0 || s.AlertInterval != time.Minute || s.StateDir != "/tmp/state" {
+		t.Errorf("settings = %+v", s)
+	}
+}
+
+func TestLoadConfigHistory(t *testing.T) {
+	t.Setenv("TOKEN", "abc")
+
+	s, err := loadConfig(writeConfig(t, "access:\n  users:\n    1: admin\nhistory:\n  raw: 30m\n  downsample: []\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []HistoryTier{{Keep: 30 * time.Minute}}; !slices.Equal(s.HistoryTiers, want) {
+		t.Errorf("tiers = %v, want %v", s.HistoryTiers, want)
+	}
+
+	_, err = loadConfig(writeConfig(t, `
+access:
+  users:
+    1: admin
+history:
+  downsample:
+    - {step: 5m, keep: 24h}
+    - {step: 1m, keep: 12h}
+    - {step: 1h}
+`))
+	for _, want := range []string{"history.downsample[1].step", "history.downsample[1].keep", "history.downsample[2].keep: not set"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigReports(t *testing.T) {
+	t.Setenv("TOKEN", "abc")
+
+	s, err := loadConfig(writeConfig(t, "access:\n  users:\n    1: admin\nreports:\n  - schedule: 0 9 * * *\n  - schedule: 0 9 * * 1\n    range: 7d\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Reports) != 2 || s.Reports[0].Range != 24*time.Hour || s.Reports[1].Range != 7*24*time.Hour {
+		t.Errorf("reports = %+v", s.Reports)
+	}
+
+	_, err = loadConfig(writeConfig(t, "access:\n  users:\n    1: admin\nreports:\n  - schedule: 0 9 * *\n  - schedule: 0 0 31 2 *\n    range: soon\n"))
+	for _, want := range []string{"reports[0].schedule", "reports[1].schedule: schedule never matches", "reports[1].range"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %v", want, err)
+		}
+	}
+}
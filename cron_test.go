@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// Wednesday.
+	from := time.Date(2024, 7, 24, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"0 9 * * *", time.Date(2024, 7, 25, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 7, 24, 9, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1", time.Date(2024, 7, 29, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 7, 28, 9, 0, 0, 0, time.UTC)},
+		{"30 8-10 * * 1-5", time.Date(2024, 7, 24, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either matches.
+		{"0 12 1 * 5", time.Date(2024, 7, 26, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.spec, err)
+		}
+		if got, err := schedule.Next(from); err != nil || !got.Equal(tt.want) {
+			t.Errorf("%q.Next() = %s, %v, want %s", tt.spec, got, err, tt.want)
+		}
+	}
+
+	if schedule, err := parseCron("0 0 31 2 *"); err != nil {
+		t.Fatal(err)
+	} else if _, err := schedule.Next(from); err == nil {
+		t.Error("February 31 matched")
+	}
+
+	for _, spec := range []string{"", "0 9 * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FixtureCollector replays recorded `nvidia-smi -q -x` output instead of running nvidia-smi.
+// It is meant for development and tests on machines without a GPU.
+type FixtureCollector struct {
+	files []string
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewFixtureCollector creates a collector from path, which is either a single XML file
+// or a directory whose *.xml files are replayed in name order, starting over after the last one.
+func NewFixtureCollector(path string) (*FixtureCollector, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixtures: %w", err)
+	}
+
+	if !info.IsDir() {
+		return &FixtureCollector{files: []string{path}}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fixtures: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no *.xml fixtures in " + path)
+	}
+	sort.Strings(files)
+
+	return &FixtureCollector{files: files}, nil
+}
+
+func (c *FixtureCollector) Collect(ctx context.Context) (*Snapshot, error) {
+	c.mu.Lock()
+	file := c.files[c.next]
+	c.next = (c.next + 1) % len(c.files)
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	results, err := parseNvidiaSmiLog(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return NewSnapshot(results, time.Now()), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixtureCollectorFile(t *testing.T) {
+	c, err := NewFixtureCollector(filepath.Join("testdata", "nvidia-smi-555.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		s, err := c.Collect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Log.DriverVersion != "555.42.06" {
+			t.Errorf("DriverVersion = %q, want %q", s.Log.DriverVersion, "555.42.06")
+		}
+	}
+}
+
+func TestFixtureCollectorDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for i, driver := range []string{"535", "470", "555"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "nvidia-smi-"+driver+".xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(dir, string(rune('a'+i))+".xml")
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := NewFixtureCollector(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"535.129.03", "470.161.03", "555.42.06", "535.129.03"}
+	for _, version := range want {
+		s, err := c.Collect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Log.DriverVersion != version {
+			t.Errorf("DriverVersion = %q, want %q", s.Log.DriverVersion, version)
+		}
+	}
+}
+
+func TestFixtureCollectorEmptyDirectory(t *testing.T) {
+	if _, err := NewFixtureCollector(t.TempDir()); err == nil {
+		t.Fatal("expected an error for a directory without fixtures")
+	}
+}
@@ -3,3 +3,12 @@ module github.com/egorsmkv/gpu-state-tgbot
 go 1.22.2
 
 require github.com/PaulSonOfLars/gotgbot/v2 v2.0.0-rc.28
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/image v0.18.0
+)
+
+require golang.org/x/sys v0.30.0 // indirect
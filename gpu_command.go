@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// gpuDetails handles /gpu <index|uuid|bus-id> and replies with an extended report for a single GPU.
+func gpuDetails(b *gotgbot.Bot, ctx *ext.Context) error {
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+
+	var message string
+	args := ctx.Args()
+	if len(args) < 2 {
+		message = "Usage: /gpu &lt;index|uuid|bus-id&gt;\n\n" + renderGPUSelectors(snapshot)
+	} else if gpu, ok := findGPU(snapshot, args[1]); ok {
+		message = renderGPUDetails(gpu)
+	} else {
+		message = fmt.Sprintf("Unknown GPU <code>%s</code>.\n\n%s", html.EscapeString(args[1]), renderGPUSelectors(snapshot))
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, withSnapshotAge(message, snapshot, time.Now()), &gotgbot.SendMessageOpts{
+		ParseMode: "html",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send gpu details: %w", err)
+	}
+
+	return nil
+}
+
+// findGPU looks a GPU up by its index, UUID or PCI bus id. Bus ids may omit the PCI domain, e.g. "02:00.0".
+func findGPU(s *Snapshot, selector string) (GPU, bool) {
+	selector = strings.TrimSpace(selector)
+
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index >= 0 && index < len(s.GPUs) {
+			return s.GPUs[index], true
+		}
+		return GPU{}, false
+	}
+
+	for _, gpu := range s.GPUs {
+		if strings.EqualFold(gpu.UUID, selector) || strings.EqualFold(gpu.UUID, "GPU-"+selector) {
+			return gpu, true
+		}
+		if busIDMatches(gpu.ID, selector) {
+			return gpu, true
+		}
+	}
+
+	return GPU{}, false
+}
+
+func busIDMatches(id, selector string) bool {
+	id, selector = strings.ToUpper(id), strings.ToUpper(selector)
+	if id == selector {
+		return true
+	}
+
+	// nvidia-smi reports 8-digit PCI domains, but lspci and the kernel use 4 digits or none at all.
+	_, short, ok := strings.Cut(id, ":")
+	if !ok {
+		return false
+	}
+	if short == selector {
+		return true
+	}
+	if domain, rest, ok := strings.Cut(selector, ":"); ok && strings.Count(selector, ":") == 2 {
+		idDomain, _, _ := strings.Cut(id, ":")
+		return rest == short && strings.TrimLeft(domain, "0") == strings.TrimLeft(idDomain, "0")
+	}
+
+	return false
+}
+
+func renderGPUSelectors(s *Snapshot) string {
+	lines := []string{"Valid GPUs:"}
+	for _, gpu := range s.GPUs {
+		lines = append(lines, fmt.Sprintf("<code>%d</code> · <code>%s</code> · <code>%s</code> (%s)", gpu.Index, gpu.UUID, gpu.ID, gpu.Name))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderGPUDetails(gpu GPU) string {
+	lines := []string{
+		fmt.Sprintf("GPU %d: <b>%s</b> (%s)", gpu.Index, gpu.Name, gpu.Architecture),
+		fmt.Sprintf("Bus ID: <code>%s</code>", gpu.ID),
+		fmt.Sprintf("UUID: <code>%s</code>", gpu.UUID),
+		fmt.Sprintf("Performance state: <b>%s</b>", gpu.PerformanceState),
+		"",
+		renderGPUClocks(gpu),
+		"",
+		fmt.Sprintf("PCIe generation: <b>%s</b> / %s", gpu.PCIeGen, gpu.PCIeMaxGen),
+		fmt.Sprintf("PCIe width: <b>%s</b> / %s", linkWidth(gpu.PCIeWidth), linkWidth(gpu.PCIeMaxWidth)),
+		"",
+		fmt.Sprintf("Power draw: <b>%s</b>", gpu.PowerDraw),
+		fmt.Sprintf("Power limit: <b>%s</b> (default %s, min %s, max %s)", gpu.PowerLimit, gpu.PowerDefaultLimit, gpu.PowerMinLimit, gpu.PowerMaxLimit),
+		"",
+		renderGPUECC(gpu),
+		"",
+		renderGPUProcessList(gpu),
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderGPUClocks(gpu GPU) string {
+	lines := []string{
+		"Clocks (current / max):",
+		fmt.Sprintf("Graphics: <b>%s</b> / %s%s", gpu.GraphicsClock, gpu.MaxGraphicsClock, clockShare(gpu.GraphicsClock, gpu.MaxGraphicsClock)),
+		fmt.Sprintf("SM: <b>%s</b> / %s%s", gpu.SMClock, gpu.MaxSMClock, clockShare(gpu.SMClock, gpu.MaxSMClock)),
+		fmt.Sprintf("Memory: <b>%s</b> / %s%s", gpu.MemClock, gpu.MaxMemClock, clockShare(gpu.MemClock, gpu.MaxMemClock)),
+	}
+	if len(gpu.ClockEventReasons) == 0 {
+		return strings.Join(append(lines, "Clock event reasons: <b>none</b>"), "\n")
+	}
+
+	lines = append(lines, "Clock event reasons:")
+	for _, reason := range gpu.ClockEventReasons {
+		lines = append(lines, "• "+describeClockEventReason(reason))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// clockShare formats a clock as a share of its maximum, e.g. " (67 %)".
+func clockShare(current, max Reading) string {
+	if !current.OK() || !max.OK() || max.Value == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (%.0f %%)", current.Value/max.Value*100)
+}
+
+func renderGPUECC(gpu GPU) string {
+	lines := []string{
+		fmt.Sprintf("ECC mode: <b>%s</b>", gpu.ECCMode),
+		"ECC errors (volatile / aggregate):",
+		fmt.Sprintf("SRAM correctable: <b>%s</b> / %s", gpu.ECCVolatile.SRAMCorrectable, gpu.ECCAggregate.SRAMCorrectable),
+		fmt.Sprintf("SRAM uncorrectable: <b>%s</b> / %s", gpu.ECCVolatile.SRAMUncorrectable, gpu.ECCAggregate.SRAMUncorrectable),
+		fmt.Sprintf("DRAM correctable: <b>%s</b> / %s", gpu.ECCVolatile.DRAMCorrectable, gpu.ECCAggregate.DRAMCorrectable),
+		fmt.Sprintf("DRAM uncorrectable: <b>%s</b> / %s", gpu.ECCVolatile.DRAMUncorrectable, gpu.ECCAggregate.DRAMUncorrectable),
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderGPUProcessList(gpu GPU) string {
+	if len(gpu.Processes) == 0 {
+		return "Processes: <b>none</b>"
+	}
+
+	lines := []string{"Processes:"}
+	for _, process := range gpu.Processes {
+		lines = append(lines, fmt.Sprintf("<code>%d</code> %s (%s): <b>%s</b>", process.PID, html.EscapeString(process.Name), process.Type, process.UsedMemory))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func linkWidth(r Reading) string {
+	if !r.OK() {
+		return r.String()
+	}
+
+	return r.String() + "x"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFindGPU(t *testing.T) {
+	s := loadFixture(t, "555")
+
+	tests := []struct {
+		selector string
+		want     int
+	}{
+		{"0", 0},
+		{"1", 1},
+		{"2", -1},
+		{"-1", -1},
+		{"GPU-1d2c3b4a-5e6f-7a8b-9c0d-e1f2a3b4c5d6", 1},
+		{"gpu-1d2c3b4a-5e6f-7a8b-9c0d-e1f2a3b4c5d6", 1},
+		{"1d2c3b4a-5e6f-7a8b-9c0d-e1f2a3b4c5d6", 1},
+		{"00000000:02:00.0", 0},
+		{"0000:03:00.0", 1},
+		{"03:00.0", 1},
+		{"04:00.0", -1},
+		{"GPU-unknown", -1},
+	}
+
+	for _, tt := range tests {
+		gpu, ok := findGPU(s, tt.selector)
+		if tt.want < 0 {
+			if ok {
+				t.Errorf("findGPU(%q) = GPU %d, want no match", tt.selector, gpu.Index)
+			}
+			continue
+		}
+		if !ok || gpu.Index != tt.want {
+			t.Errorf("findGPU(%q) = %d, %v, want %d", tt.selector, gpu.Index, ok, tt.want)
+		}
+	}
+}
+
+func TestRenderGPUDetails(t *testing.T) {
+	for _, driver := range fixtures {
+		s := loadFixture(t, driver)
+		for _, gpu := range s.GPUs {
+			t.Run(fmt.Sprintf("%s/%d", driver, gpu.Index), func(t *testing.T) {
+				checkGolden(t, fmt.Sprintf("gpu-%s-%d", driver, gpu.Index), []string{renderGPUDetails(gpu)})
+			})
+		}
+	}
+}
+
+func TestRenderGPUSelectors(t *testing.T) {
+	checkGolden(t, "gpu-selectors", []string{renderGPUSelectors(loadFixture(t, "535"))})
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"maps"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// retiredPagesRMA is the number of retired pages from which NVIDIA replaces a GPU; at most 64 can be retired.
+	retiredPagesRMA = 60
+	// memoryHealthKey is where the store keeps the last memory counters of every GPU, so that increases
+	// while the bot was down are noticed.
+	memoryHealthKey = "memory_health"
+)
+
+// HealthVerdict sums up the health of a GPU.
+type HealthVerdict int
+
+const (
+	HealthHealthy HealthVerdict = iota
+	// HealthDegraded means the GPU lost memory, needs a reset or has a degraded NVLink fabric.
+	HealthDegraded
+	// HealthRMA means the GPU has run out of ways to repair its memory and should be replaced.
+	HealthRMA
+)
+
+func (v HealthVerdict) String() string {
+	switch v {
+	case HealthDegraded:
+		return "degraded"
+	case HealthRMA:
+		return "needs RMA"
+	default:
+		return "healthy"
+	}
+}
+
+// gpuHealth returns the verdict on a GPU and what led to it: its ECC errors, retired pages and remapped rows,
+// and the device problems such as a pending reset or a failed NVLink fabric.
+func gpuHealth(gpu GPU) (HealthVerdict, []string) {
+	verdict := HealthHealthy
+	var reasons []string
+	found := func(v HealthVerdict, format string, args ...any) {
+		verdict = max(verdict, v)
+		reasons = append(reasons, fmt.Sprintf(format, args...))
+	}
+
+	if gpu.RemappedRowsFailure == "Yes" {
+		found(HealthRMA, "a row could not be remapped")
+	}
+	if banks := gpu.RowRemapHistogram.None; banks.OK() && banks.Value > 0 {
+		found(HealthRMA, "%.0f memory banks have no spare rows left", banks.Value)
+	}
+	if gpu.ECCSRAMThresholdExceeded == "Yes" {
+		found(HealthRMA, "SRAM errors passed the replacement threshold")
+	}
+	retired := 0.0
+	for _, pages := range []Reading{gpu.RetiredPagesSingleBit, gpu.RetiredPagesDoubleBit} {
+		if pages.OK() {
+			retired += pages.Value
+		}
+	}
+	switch {
+	case retired >= retiredPagesRMA:
+		found(HealthRMA, "%.0f pages are retired, from %d on the GPU should be replaced", retired, retiredPagesRMA)
+	case retired > 0:
+		found(HealthDegraded, "%.0f pages are retired", retired)
+	}
+
+	if gpu.RemappedRowsPending == "Yes" {
+		found(HealthDegraded, "rows wait to be remapped, reset the GPU")
+	}
+	if gpu.RetiredPagesPending == "Yes" {
+		found(HealthDegraded, "pages wait to be retired, reset the GPU or reboot")
+	}
+	if rows := gpu.RemappedRowsUncorrectable; rows.OK() && rows.Value > 0 {
+		found(HealthDegraded, "%.0f rows were remapped after uncorrectable errors", rows.Value)
+	}
+	if banks := gpu.RowRemapHistogram.Low; banks.OK() && banks.Value > 0 {
+		found(HealthDegraded, "%.0f memory banks are low on spare rows", banks.Value)
+	}
+	uncorrectable := 0.0
+	for _, errors := range []Reading{gpu.ECCVolatile.SRAMUncorrectable, gpu.ECCVolatile.DRAMUncorrectable} {
+		if errors.OK() {
+			uncorrectable += errors.Value
+		}
+	}
+	if uncorrectable > 0 {
+		found(HealthDegraded, "%.0f uncorrectable ECC errors since the driver was loaded", uncorrectable)
+	}
+
+	for _, problem := range deviceProblems {
+		if text := problem.check(gpu); text != "" {
+			found(HealthDegraded, "%s", text)
+		}
+	}
+
+	if gpu.ECCMode == "Disabled" {
+		reasons = append(reasons, "ECC is disabled, so memory errors go unnoticed")
+	}
+
+	return verdict, reasons
+}
+
+// renderHealth renders the health of every GPU.
+func renderHealth(s *Snapshot) string {
+	blocks := make([]string, 0, len(s.GPUs))
+	for _, gpu := range s.GPUs {
+		blocks = append(blocks, renderGPUHealth(gpu))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+func renderGPUHealth(gpu GPU) string {
+	verdict, reasons := gpuHealth(gpu)
+	lines := []string{
+		fmt.Sprintf("<b>%s</b>: <b>%s</b>", gpuLabel(gpu), verdict),
+		fmt.Sprintf("ECC %s, errors (volatile / aggregate): SRAM %s/%s corr. %s/%s uncorr., DRAM %s/%s corr. %s/%s uncorr.",
+			html.EscapeString(gpu.ECCMode),
+			gpu.ECCVolatile.SRAMCorrectable, gpu.ECCAggregate.SRAMCorrectable, gpu.ECCVolatile.SRAMUncorrectable, gpu.ECCAggregate.SRAMUncorrectable,
+			gpu.ECCVolatile.DRAMCorrectable, gpu.ECCAggregate.DRAMCorrectable, gpu.ECCVolatile.DRAMUncorrectable, gpu.ECCAggregate.DRAMUncorrectable),
+	}
+	if gpu.RetiredPagesSingleBit.OK() || gpu.RetiredPagesDoubleBit.OK() {
+		lines = append(lines, fmt.Sprintf("Retired pages: %s single bit, %s double bit, pending %s",
+			gpu.RetiredPagesSingleBit, gpu.RetiredPagesDoubleBit, html.EscapeString(gpu.RetiredPagesPending)))
+	}
+	if gpu.RemappedRowsCorrectable.OK() || gpu.RemappedRowsUncorrectable.OK() {
+		h := gpu.RowRemapHistogram
+		lines = append(lines,
+			fmt.Sprintf("Remapped rows: %s corr., %s uncorr., pending %s, failed %s",
+				gpu.RemappedRowsCorrectable, gpu.RemappedRowsUncorrectable,
+				html.EscapeString(gpu.RemappedRowsPending), html.EscapeString(gpu.RemappedRowsFailure)),
+			fmt.Sprintf("Banks by spare rows: %s max, %s high, %s partial, %s low, %s none", h.Max, h.High, h.Partial, h.Low, h.None))
+	}
+	lines = append(lines, fmt.Sprintf("Reset required: %s, drain and reset recommended: %s",
+		html.EscapeString(gpu.ResetRequired), html.EscapeString(gpu.DrainAndResetRecommended)))
+	if gpu.FabricState != "" && gpu.FabricState != "N/A" && gpu.FabricState != "Not Supported" {
+		lines = append(lines, fmt.Sprintf("NVLink fabric: %s, status %s, bandwidth %s",
+			html.EscapeString(gpu.FabricState), html.EscapeString(gpu.FabricStatus), html.EscapeString(gpu.FabricBandwidth)))
+	}
+	for _, reason := range reasons {
+		lines = append(lines, "• "+reason)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// health handles /health and replies with the health of every GPU.
+func health(b *gotgbot.Bot, ctx *ext.Context) error {
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+
+	return replyHTML(b, ctx, truncateMessage(renderHealth(snapshot), maxMessageLength))
+}
+
+// memoryCounter is a memory error counter that alerts when it grows.
+type memoryCounter struct {
+	name  string
+	value func(GPU) Reading
+}
+
+var memoryCounters = []memoryCounter{
+	{"Volatile SRAM correctable ECC errors", func(g GPU) Reading { return g.ECCVolatile.SRAMCorrectable }},
+	{"Volatile SRAM uncorrectable ECC errors", func(g GPU) Reading { return g.ECCVolatile.SRAMUncorrectable }},
+	{"Volatile DRAM correctable ECC errors", func(g GPU) Reading { return g.ECCVolatile.DRAMCorrectable }},
+	{"Volatile DRAM uncorrectable ECC errors", func(g GPU) Reading { return g.ECCVolatile.DRAMUncorrectable }},
+	{"Single bit retired pages", func(g GPU) Reading { return g.RetiredPagesSingleBit }},
+	{"Double bit retired pages", func(g GPU) Reading { return g.RetiredPagesDoubleBit }},
+	{"Rows remapped after correctable errors", func(g GPU) Reading { return g.RemappedRowsCorrectable }},
+	{"Rows remapped after uncorrectable errors", func(g GPU) Reading { return g.RemappedRowsUncorrectable }},
+}
+
+// memoryFlag is a memory health flag that alerts when it turns Yes.
+type memoryFlag struct {
+	name  string
+	value func(GPU) string
+}
+
+var memoryFlags = []memoryFlag{
+	{"Rows pending remapping", func(g GPU) string { return g.RemappedRowsPending }},
+	{"Pages pending retirement", func(g GPU) string { return g.RetiredPagesPending }},
+	{"Row remapping failure", func(g GPU) string { return g.RemappedRowsFailure }},
+	{"SRAM threshold exceeded", func(g GPU) string { return g.ECCSRAMThresholdExceeded }},
+}
+
+// deviceProblem is a condition that makes the jobs on a GPU fail until someone acts. check describes it
+// when it applies.
+type deviceProblem struct {
+	name  string
+	check func(GPU) string
+}
+
+var deviceProblems = []deviceProblem{
+	{"Reset required", func(g GPU) string {
+		if g.ResetRequired == "Yes" {
+			return "the GPU must be reset before it can run jobs again"
+		}
+		return ""
+	}},
+	{"Drain and reset recommended", func(g GPU) string {
+		if g.DrainAndResetRecommended == "Yes" {
+			return "move the jobs off the GPU and reset it"
+		}
+		return ""
+	}},
+	{"NVLink fabric", fabricProblem},
+}
+
+// fabricProblem describes a failed NVLink fabric registration or degraded fabric bandwidth.
+func fabricProblem(g GPU) string {
+	switch {
+	case g.FabricState == "Completed" && g.FabricStatus != "Success" && g.FabricStatus != "" && g.FabricStatus != "N/A":
+		return fmt.Sprintf("the NVLink fabric registration failed: %s", html.EscapeString(g.FabricStatus))
+	case g.FabricBandwidth != "" && g.FabricBandwidth != "N/A" && g.FabricBandwidth != "Full":
+		return fmt.Sprintf("the NVLink fabric bandwidth is %s, multi-GPU jobs will stall or fail", html.EscapeString(strings.ToLower(g.FabricBandwidth)))
+	}
+	return ""
+}
+
+// memoryState is what the HealthMonitor remembers about a GPU.
+type memoryState struct {
+	Counters map[string]float64 `json:"counters"`
+	Flags    map[string]bool    `json:"flags"`
+	// Problems are the device problems that were alerted.
+	Problems map[string]bool `json:"problems,omitempty"`
+}
+
+// HealthMonitor alerts when the memory error counters of a GPU grow between samples or a pending
+// remapping, retirement or failure flag turns Yes. A GPU that needs a reset or whose NVLink fabric
+// degrades raises an urgent alert at once, followed by a "resolved" message.
+type HealthMonitor struct {
+	store *Store
+	gpus  map[string]memoryState
+}
+
+// NewHealthMonitor creates a monitor that continues from the counters saved in the store.
+func NewHealthMonitor(store *Store) *HealthMonitor {
+	m := &HealthMonitor{store: store, gpus: make(map[string]memoryState)}
+	if _, err := store.Load(memoryHealthKey, &m.gpus); err != nil {
+		log.Println("failed to load memory health:", err.Error())
+	}
+
+	return m
+}
+
+func (m *HealthMonitor) Observe(s *Snapshot) []Alert {
+	var alerts []Alert
+	changed := false
+
+	for _, gpu := range s.GPUs {
+		current := memoryState{Counters: make(map[string]float64), Flags: make(map[string]bool), Problems: make(map[string]bool)}
+		for _, counter := range memoryCounters {
+			if r := counter.value(gpu); r.OK() {
+				current.Counters[counter.name] = r.Value
+			}
+		}
+		for _, flag := range memoryFlags {
+			current.Flags[flag.name] = flag.value(gpu) == "Yes"
+		}
+		var problems, resolved []string
+		previous, known := m.gpus[gpu.UUID]
+		for _, problem := range deviceProblems {
+			text := problem.check(gpu)
+			current.Problems[problem.name] = text != ""
+			switch {
+			case text != "" && !previous.Problems[problem.name]:
+				problems = append(problems, fmt.Sprintf("%s: %s", problem.name, text))
+			case text == "" && previous.Problems[problem.name]:
+				resolved = append(resolved, problem.name)
+			}
+		}
+		// Problems are urgent, so they are alerted even on the first sample of a GPU.
+		if len(problems) > 0 {
+			alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>URGENT</b> %s\n%s\nJobs on this GPU will fail until it is fixed. See /health.",
+				gpuLabel(gpu), strings.Join(problems, "\n"))})
+		}
+		if len(resolved) > 0 {
+			alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>RESOLVED</b> %s: %s", gpuLabel(gpu), strings.Join(resolved, ", "))})
+		}
+
+		if !known || !maps.Equal(previous.Counters, current.Counters) || !maps.Equal(previous.Flags, current.Flags) ||
+			!maps.Equal(previous.Problems, current.Problems) {
+			m.gpus[gpu.UUID] = current
+			changed = true
+		}
+		if !known {
+			continue
+		}
+
+		var found []string
+		for _, counter := range memoryCounters {
+			before, ok := previous.Counters[counter.name]
+			if after, ok2 := current.Counters[counter.name]; ok && ok2 && after > before {
+				found = append(found, fmt.Sprintf("%s: %.0f → <b>%.0f</b>", counter.name, before, after))
+			}
+		}
+		for _, flag := range memoryFlags {
+			if current.Flags[flag.name] && !previous.Flags[flag.name] {
+				found = append(found, fmt.Sprintf("%s: <b>Yes</b>", flag.name))
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		verdict, _ := gpuHealth(gpu)
+		alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>MEMORY</b> %s is <b>%s</b>\n%s\nSee /health.",
+			gpuLabel(gpu), verdict, strings.Join(found, "\n"))})
+	}
+
+	if changed {
+		if err := m.store.Save(memoryHealthKey, m.gpus); err != nil {
+			log.Println("failed to save memory health:", err.Error())
+		}
+	}
+
+	return alerts
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGPUHealth(t *testing.T) {
+	for _, gpu := range append(loadFixture(t, "555").GPUs, loadFixture(t, "535").GPUs[0]) {
+		if verdict, reasons := gpuHealth(gpu); verdict != HealthHealthy {
+			t.Errorf("GPU %s: %s %v", gpu.UUID, verdict, reasons)
+		}
+	}
+	// GPU 1 of the 535 fixture has remapped a row after an uncorrectable error and waits for a reset.
+	if verdict, reasons := gpuHealth(loadFixture(t, "535").GPUs[1]); verdict != HealthDegraded || len(reasons) != 2 {
+		t.Errorf("535 GPU 1: %s %v", verdict, reasons)
+	}
+
+	// The 470 fixture is a V100 with one retired page, read from the legacy ECC fields.
+	gpu := loadFixture(t, "470").GPUs[0]
+	if gpu.ECCAggregate.DRAMCorrectable.Value != 2 || !gpu.ECCAggregate.SRAMCorrectable.OK() {
+		t.Errorf("legacy ECC counters: %+v", gpu.ECCAggregate)
+	}
+	if verdict, reasons := gpuHealth(gpu); verdict != HealthDegraded || reasons[0] != "1 pages are retired" {
+		t.Errorf("470: %s %v", verdict, reasons)
+	}
+
+	gpu = loadFixture(t, "535").GPUs[0]
+	if gpu.RowRemapHistogram.Max.Value != 640 {
+		t.Errorf("histogram: %+v", gpu.RowRemapHistogram)
+	}
+	gpu.RemappedRowsPending = "Yes"
+	gpu.RowRemapHistogram.None = Reading{Value: 1}
+	verdict, reasons := gpuHealth(gpu)
+	if verdict != HealthRMA || len(reasons) != 2 {
+		t.Errorf("exhausted bank: %s %v", verdict, reasons)
+	}
+
+	text := renderGPUHealth(gpu)
+	for _, want := range []string{"<b>needs RMA</b>", "Banks by spare rows: 640 max", "• 1 memory banks have no spare rows left"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("health does not contain %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestHealthMonitor(t *testing.T) {
+	store := testStore(t)
+	s := loadFixture(t, "535")
+
+	if alerts := NewHealthMonitor(store).Observe(s); len(alerts) != 0 {
+		t.Fatalf("alerted on the first sample: %v", alerts)
+	}
+
+	// Counters that grew while the bot was down are noticed after a restart.
+	s.GPUs[0].ECCVolatile.DRAMUncorrectable.Value = 2
+	s.GPUs[0].RemappedRowsPending = "Yes"
+	m := NewHealthMonitor(store)
+	alerts := m.Observe(s)
+	if len(alerts) != 1 {
+		t.Fatalf("expected an alert for GPU 0, got %v", alerts)
+	}
+	for _, want := range []string{"<b>MEMORY</b> GPU 0", "<b>degraded</b>", "Volatile DRAM uncorrectable ECC errors: 0 → <b>2</b>", "Rows pending remapping: <b>Yes</b>"} {
+		if !strings.Contains(alerts[0].Text, want) {
+			t.Errorf("alert does not contain %q:\n%s", want, alerts[0].Text)
+		}
+	}
+	if alerts := m.Observe(s); len(alerts) != 0 {
+		t.Fatalf("alert repeated: %v", alerts)
+	}
+
+	// A reset clears the volatile counters and the pending flag without alerting.
+	s.GPUs[0].ECCVolatile.DRAMUncorrectable.Value = 0
+	s.GPUs[0].RemappedRowsPending = "No"
+	if alerts := m.Observe(s); len(alerts) != 0 {
+		t.Fatalf("alerted on a reset: %v", alerts)
+	}
+}
+
+func TestHealthMonitorDeviceProblems(t *testing.T) {
+	s := loadFixture(t, "555")
+	s.GPUs[1].ResetRequired = "Yes"
+	s.GPUs[1].FabricState = "Completed"
+	s.GPUs[1].FabricStatus = "Success"
+	s.GPUs[1].FabricBandwidth = "Degraded"
+
+	// Problems are alerted even on the first sample.
+	m := NewHealthMonitor(testStore(t))
+	alerts := m.Observe(s)
+	if len(alerts) != 1 {
+		t.Fatalf("expected an urgent alert for GPU 1, got %v", alerts)
+	}
+	for _, want := range []string{"<b>URGENT</b> GPU 1", "Reset required: the GPU must be reset", "NVLink fabric: the NVLink fabric bandwidth is degraded"} {
+		if !strings.Contains(alerts[0].Text, want) {
+			t.Errorf("alert does not contain %q:\n%s", want, alerts[0].Text)
+		}
+	}
+	if alerts := m.Observe(s); len(alerts) != 0 {
+		t.Fatalf("alert repeated: %v", alerts)
+	}
+	if verdict, _ := gpuHealth(s.GPUs[1]); verdict != HealthDegraded {
+		t.Errorf("verdict %s", verdict)
+	}
+	if text := renderGPUHealth(s.GPUs[1]); !strings.Contains(text, "NVLink fabric: Completed, status Success, bandwidth Degraded") {
+		t.Errorf("health does not show the fabric:\n%s", text)
+	}
+
+	s.GPUs[1].ResetRequired = "No"
+	s.GPUs[1].FabricBandwidth = "Full"
+	alerts = m.Observe(s)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "<b>RESOLVED</b> GPU 1 (") || !strings.Contains(alerts[0].Text, "Reset required, NVLink fabric") {
+		t.Fatalf("expected a resolved message, got %v", alerts)
+	}
+}
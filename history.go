@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryMetric is a GPU reading kept in the history.
+type HistoryMetric int
+
+const (
+	HistoryUtilization HistoryMetric = iota
+	HistoryMemory
+	HistoryTemperature
+	HistoryPower
+
+	historyMetricCount
+)
+
+var historyMetrics = [historyMetricCount]struct {
+	name, title, unit string
+	aliases           []string
+}{
+	HistoryUtilization: {"util", "GPU utilization", "%", []string{"utilization", "gpu"}},
+	HistoryMemory:      {"mem", "Memory used", "GiB", []string{"memory"}},
+	HistoryTemperature: {"temp", "Temperature", "C", []string{"temperature"}},
+	HistoryPower:       {"power", "Power draw", "W", []string{"watts"}},
+}
+
+func (m HistoryMetric) String() string { return historyMetrics[m].name }
+
+// Title is the human name of the metric.
+func (m HistoryMetric) Title() string { return historyMetrics[m].title }
+
+// Unit is the unit values of the metric are kept in.
+func (m HistoryMetric) Unit() string { return historyMetrics[m].unit }
+
+func parseHistoryMetric(s string) (HistoryMetric, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for m, info := range historyMetrics {
+		if s == info.name || slices.Contains(info.aliases, s) {
+			return HistoryMetric(m), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown metric %q, want one of %s", s, historyMetricNames())
+}
+
+func historyMetricNames() string {
+	names := make([]string, len(historyMetrics))
+	for m, info := range historyMetrics {
+		names[m] = info.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// historyValues are the values of every metric at one point in time; NaN marks a missing reading.
+type historyValues [historyMetricCount]float64
+
+func gpuHistoryValues(gpu GPU) historyValues {
+	values := historyValues{math.NaN(), math.NaN(), math.NaN(), math.NaN()}
+	if gpu.GPUUtil.OK() {
+		values[HistoryUtilization] = gpu.GPUUtil.Value
+	}
+	if gpu.MemoryUsed.OK() {
+		values[HistoryMemory] = gpu.MemoryUsed.Value / (1 << 30)
+	}
+	if gpu.Temperature.OK() {
+		values[HistoryTemperature] = gpu.Temperature.Value
+	}
+	if gpu.PowerDraw.OK() {
+		values[HistoryPower] = gpu.PowerDraw.Value
+	}
+
+	return values
+}
+
+type historyPoint struct {
+	Time   time.Time
+	Values historyValues
+}
+
+// historyRing is a fixed-size circular buffer of points, oldest first.
+type historyRing struct {
+	points []historyPoint
+	start  int
+	size   int
+}
+
+func newHistoryRing(capacity int) *historyRing {
+	return &historyRing{points: make([]historyPoint, capacity)}
+}
+
+func (r *historyRing) push(p historyPoint) {
+	if len(r.points) == 0 {
+		return
+	}
+	if r.size < len(r.points) {
+		r.points[(r.start+r.size)%len(r.points)] = p
+		r.size++
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+// resize changes the capacity of the ring, keeping the newest points that fit.
+func (r *historyRing) resize(capacity int) {
+	points := make([]historyPoint, capacity)
+	keep := min(r.size, capacity)
+	for i := 0; i < keep; i++ {
+		points[i] = r.at(r.size - keep + i)
+	}
+	r.points, r.start, r.size = points, 0, keep
+}
+
+func (r *historyRing) at(i int) historyPoint {
+	return r.points[(r.start+i)%len(r.points)]
+}
+
+func (r *historyRing) last() (historyPoint, bool) {
+	if r.size == 0 {
+		return historyPoint{}, false
+	}
+	return r.at(r.size - 1), true
+}
+
+// HistoryTier keeps samples for Keep, averaged over Step. A zero Step keeps every sample.
+type HistoryTier struct {
+	Step time.Duration
+	Keep time.Duration
+}
+
+// Name identifies the tier in the store.
+func (t HistoryTier) Name() string {
+	if t.Step == 0 {
+		return "raw"
+	}
+	return t.Step.String()
+}
+
+// defaultHistoryTiers keep every sample for an hour, minute averages for a day and 10 minute averages for a week.
+var defaultHistoryTiers = []HistoryTier{
+	{Step: 0, Keep: time.Hour},
+	{Step: time.Minute, Keep: 24 * time.Hour},
+	{Step: 10 * time.Minute, Keep: 7 * 24 * time.Hour},
+}
+
+// historyTier is the ring of one HistoryTier plus the bucket it is averaging.
+type historyTier struct {
+	HistoryTier
+	ring *historyRing
+
+	bucket time.Time
+	sum    historyValues
+	count  [historyMetricCount]int
+}
+
+// add adds a sample and returns the point it completes, if any: the sample itself for raw tiers,
+// the average of the previous bucket for the others.
+func (t *historyTier) add(p historyPoint) (historyPoint, bool) {
+	if t.Step == 0 {
+		t.ring.push(p)
+		return p, true
+	}
+
+	var completed historyPoint
+	bucket := p.Time.Truncate(t.Step)
+	flush := !t.bucket.IsZero() && !bucket.Equal(t.bucket)
+	if flush {
+		completed = t.average()
+		t.ring.push(completed)
+		t.sum, t.count = historyValues{}, [historyMetricCount]int{}
+	}
+	t.bucket = bucket
+	for m, value := range p.Values {
+		if !math.IsNaN(value) {
+			t.sum[m] += value
+			t.count[m]++
+		}
+	}
+	return completed, flush
+}
+
+// average is the point of the bucket being filled.
+func (t *historyTier) average() historyPoint {
+	p := historyPoint{Time: t.bucket}
+	for m := range p.Values {
+		p.Values[m] = math.NaN()
+		if t.count[m] > 0 {
+			p.Values[m] = t.sum[m] / float64(t.count[m])
+		}
+	}
+	return p
+}
+
+// points returns the points at or after since, including the bucket being filled.
+func (t *historyTier) points(since time.Time) []historyPoint {
+	var points []historyPoint
+	for i := 0; i < t.ring.size; i++ {
+		if p := t.ring.at(i); !p.Time.Before(since) {
+			points = append(points, p)
+		}
+	}
+	if t.Step != 0 && !t.bucket.IsZero() && !t.bucket.Before(since.Truncate(t.Step)) {
+		points = append(points, t.average())
+	}
+	return points
+}
+
+// historyPruneInterval is how often points older than their tier keeps them are deleted from the store.
+const historyPruneInterval = time.Hour
+
+// History keeps recent readings of every GPU in memory and in the store. It is an Observer fed by the poller.
+type History struct {
+	// interval is how often the poller samples, which sizes the tier keeping every sample.
+	interval time.Duration
+	tiers    []HistoryTier
+
+	mu     sync.Mutex
+	gpus   map[string][]*historyTier
+	store  *Store
+	pruned time.Time
+}
+
+// NewHistory creates a history with tiers sorted from the finest to the coarsest step,
+// sampled every interval.
+func NewHistory(tiers []HistoryTier, interval time.Duration) *History {
+	return &History{interval: interval, tiers: tiers, gpus: make(map[string][]*historyTier)}
+}
+
+func (h *History) Observe(s *Snapshot) []Alert {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var points []storedPoint
+	for _, gpu := range s.GPUs {
+		tiers, ok := h.gpus[gpu.UUID]
+		if !ok {
+			tiers = h.newTiers()
+			h.gpus[gpu.UUID] = tiers
+		}
+		// A snapshot shared through the cache may be observed twice.
+		if last, ok := tiers[0].ring.last(); ok && !s.CollectedAt.After(last.Time) {
+			continue
+		}
+
+		p := historyPoint{Time: s.CollectedAt, Values: gpuHistoryValues(gpu)}
+		for _, tier := range tiers {
+			if completed, ok := tier.add(p); ok {
+				points = append(points, storedPoint{GPU: gpu.UUID, Tier: tier.Name(), Point: completed})
+			}
+		}
+	}
+
+	if err := h.store.AddPoints(points); err != nil {
+		log.Println("failed to save gpu history:", err.Error())
+	}
+	if s.CollectedAt.Sub(h.pruned) >= historyPruneInterval {
+		h.pruned = s.CollectedAt
+		if _, err := h.store.Prune(h.tiers, s.CollectedAt); err != nil {
+			log.Println("failed to prune gpu history:", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Restore loads the history saved in store and keeps saving new readings there.
+func (h *History) Restore(store *Store, now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.store = store
+	for i, tier := range h.tiers {
+		err := store.EachPoint(tier.Name(), now.Add(-tier.Keep), func(gpu string, p historyPoint) {
+			tiers, ok := h.gpus[gpu]
+			if !ok {
+				tiers = h.newTiers()
+				h.gpus[gpu] = tiers
+			}
+			tiers[i].ring.push(p)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load gpu history: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (h *History) newTiers() []*historyTier {
+	tiers := make([]*historyTier, len(h.tiers))
+	for i, tier := range h.tiers {
+		tiers[i] = &historyTier{HistoryTier: tier, ring: newHistoryRing(h.capacity(tier))}
+	}
+	return tiers
+}
+
+// capacity is how many points a tier keeps.
+func (h *History) capacity(tier HistoryTier) int {
+	step := tier.Step
+	if step == 0 {
+		step = h.interval
+	}
+	return int(tier.Keep/step) + 1
+}
+
+// SetInterval applies a new sampling interval and resizes the tiers keeping every sample to it.
+func (h *History) SetInterval(interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.interval = interval
+	for _, tiers := range h.gpus {
+		for _, tier := range tiers {
+			if tier.Step == 0 {
+				tier.ring.resize(h.capacity(tier.HistoryTier))
+			}
+		}
+	}
+}
+
+// Retention is how long the coarsest tier keeps samples.
+func (h *History) Retention() time.Duration {
+	if len(h.tiers) == 0 {
+		return 0
+	}
+	return h.tiers[len(h.tiers)-1].Keep
+}
+
+// Query returns the readings of metric for the GPU with uuid since the given time from the finest
+// tier that keeps the whole range, and the resolution of the readings.
+func (h *History) Query(uuid string, metric HistoryMetric, since, now time.Time) ([]chartPoint, time.Duration) {
+	var points []chartPoint
+	all, step := h.Points(uuid, since, now)
+	for _, p := range all {
+		if value := p.Values[metric]; !math.IsNaN(value) {
+			points = append(points, chartPoint{Time: p.Time, Value: value})
+		}
+	}
+
+	return points, step
+}
+
+// Points is Query for every metric at once.
+func (h *History) Points(uuid string, since, now time.Time) ([]historyPoint, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tiers := h.gpus[uuid]
+	if len(tiers) == 0 {
+		return nil, 0
+	}
+
+	tier := tiers[len(tiers)-1]
+	for _, t := range tiers {
+		if now.Sub(since) <= t.Keep {
+			tier = t
+			break
+		}
+	}
+	if oldest := now.Add(-tier.Keep); since.Before(oldest) {
+		since = oldest
+	}
+
+	step := tier.Step
+	if step == 0 {
+		step = h.interval
+	}
+	return tier.points(since), step
+}
+
+// GPUs returns the UUIDs of the GPUs with readings.
+func (h *History) GPUs() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	uuids := make([]string, 0, len(h.gpus))
+	for uuid := range h.gpus {
+		uuids = append(uuids, uuid)
+	}
+	slices.Sort(uuids)
+	return uuids
+}
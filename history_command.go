@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// history keeps the readings the poller samples; it is created in main once the settings are known.
+var history *History
+
+const historyUsage = "Usage: /history &lt;gpu&gt; &lt;metric&gt; [range], e.g. /history 0 temp 6h\nMetrics: "
+
+// historyChart handles /history <gpu> <metric> [range] and replies with a chart of the metric.
+func historyChart(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+	if len(args) < 2 || len(args) > 3 {
+		return replyHTML(b, ctx, historyUsage+historyMetricNames())
+	}
+
+	metric, err := parseHistoryMetric(args[1])
+	if err != nil {
+		return replyHTML(b, ctx, html.EscapeString(err.Error())+".\n"+historyUsage+historyMetricNames())
+	}
+	rangeArg := "1h"
+	if len(args) == 3 {
+		rangeArg = args[2]
+	}
+	span, err := parseHistoryRange(rangeArg)
+	if err != nil {
+		return replyHTML(b, ctx, html.EscapeString(err.Error())+".\n"+historyUsage+historyMetricNames())
+	}
+
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+	gpu, ok := findGPU(snapshot, args[0])
+	if !ok {
+		return replyHTML(b, ctx, fmt.Sprintf("Unknown GPU <code>%s</code>.\n\n%s", html.EscapeString(args[0]), renderGPUSelectors(snapshot)))
+	}
+
+	now := time.Now()
+	caption, chart, ok := renderHistory(history, gpu, metric, span, rangeArg, now)
+	if !ok {
+		return replyHTML(b, ctx, caption)
+	}
+
+	image, err := renderChart(chart)
+	if err != nil {
+		return err
+	}
+	_, err = b.SendPhoto(ctx.EffectiveChat.Id, gotgbot.InputFileByReader("history.png", bytes.NewReader(image)), &gotgbot.SendPhotoOpts{
+		Caption:   caption,
+		ParseMode: "html",
+		ReplyParameters: &gotgbot.ReplyParameters{
+			MessageId:                ctx.EffectiveMessage.MessageId,
+			AllowSendingWithoutReply: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send history chart: %w", err)
+	}
+
+	return nil
+}
+
+// renderHistory builds the chart of metric over the last span and its caption. Without readings it
+// returns false and a message explaining why instead.
+func renderHistory(h *History, gpu GPU, metric HistoryMetric, span time.Duration, rangeArg string, now time.Time) (string, lineChart, bool) {
+	title := fmt.Sprintf("<b>%s</b>\n%s over the last %s", gpuLabel(gpu), metric.Title(), html.EscapeString(rangeArg))
+
+	points, step := h.Query(gpu.UUID, metric, now.Add(-span), now)
+	if len(points) == 0 {
+		return title + ": no readings yet. The history fills up while the bot runs.", lineChart{}, false
+	}
+
+	low, high, sum := points[0].Value, points[0].Value, 0.0
+	for _, p := range points {
+		low, high, sum = min(low, p.Value), max(high, p.Value), sum+p.Value
+	}
+	format := func(v float64) string {
+		if metric == HistoryMemory {
+			return fmt.Sprintf("%.1f %s", v, metric.Unit())
+		}
+		return fmt.Sprintf("%.0f %s", v, metric.Unit())
+	}
+	caption := fmt.Sprintf("%s\nmin %s, avg %s, max %s", title, format(low), format(sum/float64(len(points))), format(high))
+	if step > 0 && span > 10*step {
+		caption += fmt.Sprintf("\n<i>%s averages</i>", formatSpan(step))
+	}
+	if retention := h.Retention(); span > retention {
+		caption += fmt.Sprintf("\n<i>Only the last %s are kept.</i>", formatSpan(retention))
+	}
+
+	chart := lineChart{
+		Points: points,
+		From:   now.Add(-span),
+		To:     now,
+		Unit:   metric.Unit(),
+		Gap:    3 * step,
+	}
+	switch metric {
+	case HistoryUtilization:
+		chart.Max = 100
+	case HistoryMemory:
+		if gpu.MemoryTotal.OK() {
+			chart.Max = gpu.MemoryTotal.Value / (1 << 30)
+		}
+	}
+
+	return caption, chart, true
+}
+
+// maxHistoryRange is the longest range /history and reports accept, longer than any history is kept.
+const maxHistoryRange = 10 * 365 * 24 * time.Hour
+
+// parseHistoryRange parses a Go duration or a number of days or weeks, such as "6h", "2d" or "1w".
+func parseHistoryRange(s string) (time.Duration, error) {
+	// A count of days or weeks is checked before it is multiplied, which could overflow.
+	count := func(text string, unit time.Duration) (time.Duration, error) {
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return 0, err
+		}
+		if n > int(maxHistoryRange/unit) {
+			return 0, errors.New("too long")
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	var span time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		span, err = count(days, 24*time.Hour)
+	} else if weeks, ok := strings.CutSuffix(s, "w"); ok {
+		span, err = count(weeks, 7*24*time.Hour)
+	} else {
+		span, err = time.ParseDuration(s)
+	}
+	if err != nil || span <= 0 {
+		return 0, fmt.Errorf("invalid range %q", s)
+	}
+	if span > maxHistoryRange {
+		return 0, fmt.Errorf("range %q is longer than %s", s, formatSpan(maxHistoryRange))
+	}
+
+	return span, nil
+}
+
+// formatSpan formats whole days, hours and minutes without the zero units time.Duration prints, e.g. "7d" or "10m".
+func formatSpan(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func replyHTML(b *gotgbot.Bot, ctx *ext.Context, text string) error {
+	_, err := ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+		ParseMode: "html",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	return nil
+}
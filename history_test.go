@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func historySnapshot(t *testing.T, at time.Time, util float64) *Snapshot {
+	t.Helper()
+
+	s := loadFixture(t, "535")
+	s.CollectedAt = at
+	for i := range s.GPUs {
+		s.GPUs[i].GPUUtil = Reading{Value: util, Unit: UnitPercent, Status: StatusOK}
+	}
+	return s
+}
+
+func TestHistoryRing(t *testing.T) {
+	r := newHistoryRing(3)
+	for i := 0; i < 5; i++ {
+		r.push(historyPoint{Time: time.Unix(int64(i), 0)})
+	}
+
+	if r.size != 3 {
+		t.Fatalf("size = %d, want 3", r.size)
+	}
+	for i := 0; i < r.size; i++ {
+		if got := r.at(i).Time.Unix(); got != int64(i+2) {
+			t.Errorf("at(%d) = %d, want %d", i, got, i+2)
+		}
+	}
+
+	// Shrinking keeps the newest points, growing keeps them all.
+	r.resize(2)
+	r.resize(4)
+	r.push(historyPoint{Time: time.Unix(5, 0)})
+	if r.size != 3 || r.at(0).Time.Unix() != 3 || r.at(2).Time.Unix() != 5 {
+		t.Errorf("after resizing: size %d, first %d, last %d", r.size, r.at(0).Time.Unix(), r.at(r.size-1).Time.Unix())
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	start := time.Date(2024, 7, 24, 12, 0, 0, 0, time.UTC)
+	h := NewHistory([]HistoryTier{{Keep: 10 * time.Minute}, {Step: time.Minute, Keep: time.Hour}}, 10*time.Second)
+
+	// Two hours of samples, alternating between 0 and 100 % utilization.
+	var now time.Time
+	for i := 0; i < 720; i++ {
+		now = start.Add(time.Duration(i) * 10 * time.Second)
+		h.Observe(historySnapshot(t, now, float64(i%2*100)))
+	}
+	// The cached snapshot observed again is ignored.
+	h.Observe(historySnapshot(t, now, 0))
+
+	uuid := loadFixture(t, "535").GPUs[0].UUID
+	raw, step := h.Query(uuid, HistoryUtilization, now.Add(-5*time.Minute), now)
+	if step != 10*time.Second || len(raw) != 31 {
+		t.Errorf("raw query = %d points every %s, want 31 every 10s", len(raw), step)
+	}
+
+	averaged, step := h.Query(uuid, HistoryUtilization, now.Add(-30*time.Minute), now)
+	if step != time.Minute || len(averaged) != 30 {
+		t.Errorf("averaged query = %d points every %s, want 30 every 1m", len(averaged), step)
+	}
+	for _, p := range averaged[:len(averaged)-1] {
+		if p.Value != 50 {
+			t.Errorf("average at %s = %v, want 50", p.Time, p.Value)
+		}
+	}
+
+	// Only the last hour is kept.
+	all, _ := h.Query(uuid, HistoryUtilization, now.Add(-3*time.Hour), now)
+	if len(all) == 0 || now.Sub(all[0].Time) > time.Hour {
+		t.Errorf("query beyond retention starts at %s", all[0].Time)
+	}
+
+	if points, _ := h.Query("GPU-unknown", HistoryUtilization, start, now); points != nil {
+		t.Errorf("unknown GPU has %d points", len(points))
+	}
+}
+
+func TestHistorySetInterval(t *testing.T) {
+	start := time.Date(2024, 7, 24, 12, 0, 0, 0, time.UTC)
+	h := NewHistory([]HistoryTier{{Keep: 10 * time.Minute}}, 10*time.Second)
+	for i := 0; i < 60; i++ {
+		h.Observe(historySnapshot(t, start.Add(time.Duration(i)*10*time.Second), 50))
+	}
+
+	// A longer interval keeps the same span in fewer points.
+	h.SetInterval(time.Minute)
+	now := start.Add(20 * time.Minute)
+	for at := start.Add(10 * time.Minute); !at.After(now); at = at.Add(time.Minute) {
+		h.Observe(historySnapshot(t, at, 50))
+	}
+
+	uuid := loadFixture(t, "535").GPUs[0].UUID
+	points, step := h.Query(uuid, HistoryUtilization, now.Add(-10*time.Minute), now)
+	if step != time.Minute || len(points) != 11 || !points[0].Time.Equal(now.Add(-10*time.Minute)) {
+		t.Errorf("query after SetInterval = %d points every %s", len(points), step)
+	}
+}
+
+func TestHistoryMissingReadings(t *testing.T) {
+	values := gpuHistoryValues(GPU{Temperature: Reading{Value: 50}, PowerDraw: Reading{Status: StatusMissing}})
+	if values[HistoryTemperature] != 50 || !math.IsNaN(values[HistoryPower]) {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestRenderHistory(t *testing.T) {
+	start := time.Date(2024, 7, 24, 12, 0, 0, 0, time.Local)
+	h := NewHistory(defaultHistoryTiers, 30*time.Second)
+	gpu := loadFixture(t, "535").GPUs[0]
+
+	now := start
+	if caption, _, ok := renderHistory(h, gpu, HistoryTemperature, time.Hour, "1h", now); ok || !strings.Contains(caption, "no readings") {
+		t.Errorf("empty history: %q, %v", caption, ok)
+	}
+
+	for i := 0; i < 240; i++ {
+		now = start.Add(time.Duration(i) * 30 * time.Second)
+		h.Observe(historySnapshot(t, now, float64(i%100)))
+	}
+
+	caption, chart, ok := renderHistory(h, gpu, HistoryUtilization, 3*time.Hour, "3h", now)
+	if !ok || !strings.Contains(caption, "min 0 %, avg") || !strings.Contains(caption, "1m averages") || chart.Max != 100 {
+		t.Errorf("caption = %q, chart max = %v", caption, chart.Max)
+	}
+
+	image, err := renderChart(chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("chart is not a PNG: %v", err)
+	}
+	if size := decoded.Bounds().Size(); size.X != chartWidth || size.Y != chartHeight {
+		t.Errorf("chart size = %v", size)
+	}
+}
+
+func TestParseHistoryRange(t *testing.T) {
+	for input, want := range map[string]time.Duration{"90m": 90 * time.Minute, "2d": 48 * time.Hour, "1w": 7 * 24 * time.Hour, "3650d": maxHistoryRange} {
+		if got, err := parseHistoryRange(input); err != nil || got != want {
+			t.Errorf("parseHistoryRange(%q) = %s, %v, want %s", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "0s", "-1h", "xd", "soon", "3651d", "522w", "106752d", "9223372036854775807d", "15250w", "100000h"} {
+		if _, err := parseHistoryRange(input); err == nil {
+			t.Errorf("parseHistoryRange(%q) succeeded", input)
+		}
+	}
+}
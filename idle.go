@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// defaultIdleWindow is how long a GPU may hold memory while idle before its users are notified.
+	defaultIdleWindow = 2 * time.Hour
+	// defaultIdleMinMemory is the memory a GPU must hold to count as allocated.
+	defaultIdleMinMemory = gib
+
+	// idleStateKey is where the store keeps since when GPUs are idle, so that a restart does not restart the window.
+	idleStateKey = "idle_gpus"
+	// idleOptOutKey is where the store keeps the Unix users that opted out of idle notices.
+	idleOptOutKey = "idle_opt_out"
+)
+
+// idleGPU is a GPU holding memory while idle.
+type idleGPU struct {
+	Since    time.Time `json:"since"`
+	Notified bool      `json:"notified"`
+}
+
+// IdleDetector notifies the chats about GPUs that hold memory at idle utilization for longer than Window,
+// naming the users and PIDs of their processes.
+type IdleDetector struct {
+	Window    time.Duration
+	MinMemory float64
+	// AllowUsers and AllowProcesses are never reported, e.g. inference servers that are idle by design.
+	AllowUsers     []string
+	AllowProcesses []string
+	// UnixUsers maps Telegram users to Unix users, to mention the owners of the processes.
+	UnixUsers map[int64]string
+
+	procs   *ProcFS
+	optOuts *IdleOptOuts
+	store   *Store
+	idle    map[string]*idleGPU
+}
+
+// NewIdleDetector creates a detector from the settings that continues with the idle GPUs saved in the store
+// and leaves out the users in optOuts.
+func NewIdleDetector(s *Settings, procs *ProcFS, optOuts *IdleOptOuts, store *Store) *IdleDetector {
+	d := &IdleDetector{
+		Window:         s.IdleWindow,
+		MinMemory:      s.IdleMinMemory,
+		AllowUsers:     s.IdleAllowUsers,
+		AllowProcesses: s.IdleAllowProcesses,
+		UnixUsers:      s.UnixUsers,
+		procs:          procs,
+		optOuts:        optOuts,
+		store:          store,
+		idle:           make(map[string]*idleGPU),
+	}
+	if _, err := store.Load(idleStateKey, &d.idle); err != nil {
+		log.Println("failed to load idle gpus:", err.Error())
+	}
+
+	return d
+}
+
+func (d *IdleDetector) Observe(s *Snapshot) []Alert {
+	var alerts []Alert
+	changed := false
+
+	seen := make(map[string]bool)
+	for _, gpu := range s.GPUs {
+		seen[gpu.UUID] = true
+		state, wasIdle := d.idle[gpu.UUID]
+
+		if !d.isIdle(gpu) {
+			if wasIdle {
+				delete(d.idle, gpu.UUID)
+				changed = true
+			}
+			continue
+		}
+		if !wasIdle {
+			state = &idleGPU{Since: s.CollectedAt}
+			d.idle[gpu.UUID] = state
+			changed = true
+		}
+
+		if !state.Notified && s.CollectedAt.Sub(state.Since) >= d.Window {
+			state.Notified = true
+			changed = true
+			if text, ok := d.renderNotice(gpu, s.CollectedAt.Sub(state.Since)); ok {
+				alerts = append(alerts, Alert{Text: text})
+			}
+		}
+	}
+	for uuid := range d.idle {
+		if !seen[uuid] {
+			delete(d.idle, uuid)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := d.store.Save(idleStateKey, d.idle); err != nil {
+			log.Println("failed to save idle gpus:", err.Error())
+		}
+	}
+
+	return alerts
+}
+
+// isIdle reports whether the GPU holds at least MinMemory at idle utilization.
+func (d *IdleDetector) isIdle(gpu GPU) bool {
+	return gpu.GPUUtil.OK() && gpu.GPUUtil.Value < idleUtilization &&
+		gpu.MemoryUsed.OK() && gpu.MemoryUsed.Value >= d.MinMemory && len(gpu.Processes) > 0
+}
+
+// renderNotice names the processes holding the GPU. It reports false when every process is allowed
+// or belongs to a user that opted out.
+func (d *IdleDetector) renderNotice(gpu GPU, idleFor time.Duration) (string, bool) {
+	lines := []string{fmt.Sprintf("<b>IDLE</b> %s: <b>%s</b> allocated at %s utilization for %s",
+		gpuLabel(gpu), formatGiB(gpu.MemoryUsed), gpu.GPUUtil, formatDuration(idleFor))}
+	var named bool
+	for _, process := range gpu.Processes {
+		user := "unknown user"
+		if info, err := d.procs.Process(process.PID, process.Name); err == nil {
+			user = info.User
+		}
+		if slices.Contains(d.AllowUsers, user) || d.optOuts.Contains(user) || d.allowedProcess(process.Name) {
+			continue
+		}
+
+		named = true
+		lines = append(lines, fmt.Sprintf("<code>%d</code> %s · %s · %s",
+			process.PID, html.EscapeString(process.Name), d.mention(user), process.UsedMemory))
+	}
+	if !named {
+		return "", false
+	}
+
+	lines = append(lines, "Please free the GPU if it is not needed. /idle_optout stops these notices for your processes.")
+	return strings.Join(lines, "\n"), true
+}
+
+func (d *IdleDetector) allowedProcess(name string) bool {
+	return slices.Contains(d.AllowProcesses, name) || slices.Contains(d.AllowProcesses, filepath.Base(name))
+}
+
+// mention names a Unix user and links the Telegram users mapped to it.
+func (d *IdleDetector) mention(user string) string {
+	text := "<b>" + html.EscapeString(user) + "</b>"
+	for _, id := range telegramUsers(d.UnixUsers, user) {
+		text += fmt.Sprintf(` (<a href="tg://user?id=%d">Telegram</a>)`, id)
+	}
+	return text
+}
+
+// telegramUsers returns the sorted Telegram users mapped to the Unix user.
+func telegramUsers(unixUsers map[int64]string, user string) []int64 {
+	var ids []int64
+	for id, name := range unixUsers {
+		if name == user {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// IdleOptOuts is the list of Unix users that opted out of idle notices. It is kept in memory, so that it
+// works without a store, and saved in the store when there is one.
+type IdleOptOuts struct {
+	mu    sync.Mutex
+	users []string
+	store *Store
+}
+
+// NewIdleOptOuts creates the list with the users saved in the store.
+func NewIdleOptOuts(store *Store) *IdleOptOuts {
+	o := &IdleOptOuts{store: store}
+	if _, err := store.Load(idleOptOutKey, &o.users); err != nil {
+		log.Println("failed to load idle opt-outs:", err.Error())
+	}
+
+	return o
+}
+
+// Contains reports whether the user opted out.
+func (o *IdleOptOuts) Contains(user string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return slices.Contains(o.users, user)
+}
+
+// Set adds or removes the user and reports whether the list changed. The change is kept even when it
+// cannot be saved.
+func (o *IdleOptOuts) Set(user string, optOut bool) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if slices.Contains(o.users, user) == optOut {
+		return false, nil
+	}
+
+	if optOut {
+		o.users = append(o.users, user)
+		slices.Sort(o.users)
+	} else {
+		o.users = slices.DeleteFunc(o.users, func(u string) bool { return u == user })
+	}
+	return true, o.store.Save(idleOptOutKey, o.users)
+}
+
+var idleOptOuts *IdleOptOuts
+
+// idleOptOut handles /idle_optout [user] and /idle_optin [user]. Without a user they apply to the Unix user
+// the sender is mapped to; naming another user takes an admin.
+func idleOptOut(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()
+	optOut := strings.HasPrefix(args[0], "/idle_optout")
+
+	user := settings.Load().UnixUsers[ctx.EffectiveSender.Id()]
+	switch {
+	case len(args) > 2:
+		return replyHTML(b, ctx, "Usage: /idle_optout [user] or /idle_optin [user]")
+	case len(args) == 2 && args[1] != user:
+		if senderRole(ctx) < RoleAdmin {
+			return replyHTML(b, ctx, "Only admins can change the idle notices of other users.")
+		}
+		user = args[1]
+	case user == "":
+		return replyHTML(b, ctx, fmt.Sprintf("Your Telegram account is not mapped to a Unix user, ask an admin to add it to <code>access.unix_users</code> (user %d).",
+			ctx.EffectiveSender.Id()))
+	}
+
+	changed, err := idleOptOuts.Set(user, optOut)
+
+	reply := fmt.Sprintf("Idle GPU notices are on for <b>%s</b>.", html.EscapeString(user))
+	if optOut {
+		reply = fmt.Sprintf("Idle GPU notices are off for <b>%s</b>; /idle_optin turns them back on.", html.EscapeString(user))
+	}
+	if !changed {
+		reply = "Nothing changed. " + reply
+	}
+	if err != nil || changed && store == nil {
+		if err != nil {
+			log.Println("failed to save idle opt-outs:", err.Error())
+		}
+		reply += " The change could not be saved and lasts until the bot restarts."
+	}
+	return replyHTML(b, ctx, reply)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdleDetector(t *testing.T) {
+	store := testStore(t)
+	s := loadFixture(t, "555")
+	start := s.CollectedAt
+	settings := &Settings{
+		IdleWindow:         2 * time.Hour,
+		IdleMinMemory:      gib,
+		IdleAllowProcesses: []string{"python3"},
+		UnixUsers:          map[int64]string{11: "alice"},
+	}
+	optOuts := NewIdleOptOuts(store)
+	d := NewIdleDetector(settings, testProcFS(), optOuts, store)
+
+	observe := func(d *IdleDetector, after time.Duration, util float64) []Alert {
+		s.CollectedAt = start.Add(after)
+		for i := range s.GPUs {
+			s.GPUs[i].GPUUtil = Reading{Value: util}
+		}
+		return d.Observe(s)
+	}
+
+	if alerts := observe(d, 0, 0); len(alerts) != 0 {
+		t.Fatalf("alerted at once: %v", alerts)
+	}
+	if alerts := observe(d, time.Hour, 0); len(alerts) != 0 {
+		t.Fatalf("alerted within the window: %v", alerts)
+	}
+
+	// A restart keeps counting from the start of the idle period.
+	d = NewIdleDetector(settings, testProcFS(), optOuts, store)
+	alerts := observe(d, 2*time.Hour, 0)
+	// GPU 1 only runs python3, which is allowed.
+	if len(alerts) != 1 {
+		t.Fatalf("expected a notice for GPU 0, got %v", alerts)
+	}
+	for _, want := range []string{"IDLE", "GPU 0", "<code>412873</code>", "<b>alice</b>", "tg://user?id=11", "for 2h0m"} {
+		if !strings.Contains(alerts[0].Text, want) {
+			t.Errorf("notice does not contain %q:\n%s", want, alerts[0].Text)
+		}
+	}
+	if alerts := observe(d, 3*time.Hour, 0); len(alerts) != 0 {
+		t.Fatalf("notice repeated: %v", alerts)
+	}
+
+	// Work resets the window, and users that opted out are not named.
+	observe(d, 4*time.Hour, 80)
+	if _, err := optOuts.Set("alice", true); err != nil {
+		t.Fatal(err)
+	}
+	observe(d, 5*time.Hour, 0)
+	if alerts := observe(d, 7*time.Hour, 0); len(alerts) != 0 {
+		t.Fatalf("opted out user notified: %v", alerts)
+	}
+
+	if changed, err := optOuts.Set("alice", true); changed || err != nil {
+		t.Errorf("opting out twice = %v, %v", changed, err)
+	}
+	if changed, err := optOuts.Set("alice", false); !changed || err != nil {
+		t.Errorf("opting in = %v, %v", changed, err)
+	}
+	observe(d, 8*time.Hour, 80)
+	observe(d, 9*time.Hour, 0)
+	if alerts := observe(d, 11*time.Hour, 0); len(alerts) != 1 {
+		t.Fatalf("expected a notice after opting in, got %v", alerts)
+	}
+}
+
+func TestIdleOptOuts(t *testing.T) {
+	store := testStore(t)
+	if _, err := NewIdleOptOuts(store).Set("alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if !NewIdleOptOuts(store).Contains("alice") {
+		t.Error("opt-out was not saved")
+	}
+
+	// Without a store the opt-out still holds until a restart.
+	optOuts := NewIdleOptOuts(nil)
+	if changed, err := optOuts.Set("bob", true); !changed || err != nil || !optOuts.Contains("bob") {
+		t.Errorf("opting out without a store = %v, %v", changed, err)
+	}
+}
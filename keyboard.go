@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// navPrefix starts the callback data of every navigation button.
+const navPrefix = "nav:"
+
+// navView is a screen reachable through the inline keyboard attached to /state.
+type navView string
+
+const (
+	navSummary   navView = "state"
+	navGPU       navView = "gpu"
+	navProcesses navView = "proc"
+	navClocks    navView = "clk"
+	navECC       navView = "ecc"
+)
+
+// gpusPerRow is the number of GPU buttons in a row of the summary keyboard.
+const gpusPerRow = 4
+
+// navTarget is a view and the GPU it shows. GPU is -1 for views about every GPU.
+type navTarget struct {
+	View navView
+	GPU  int
+}
+
+func (t navTarget) data() string {
+	if t.GPU < 0 {
+		return navPrefix + string(t.View)
+	}
+
+	return fmt.Sprintf("%s%s:%d", navPrefix, t.View, t.GPU)
+}
+
+// parseNavData parses callback data such as "nav:state", "nav:proc" or "nav:ecc:1".
+func parseNavData(data string) (navTarget, error) {
+	rest, ok := strings.CutPrefix(data, navPrefix)
+	if !ok {
+		return navTarget{}, errors.New("not a navigation button")
+	}
+
+	view, index, hasGPU := strings.Cut(rest, ":")
+	target := navTarget{View: navView(view), GPU: -1}
+
+	switch target.View {
+	case navSummary:
+		if hasGPU {
+			return navTarget{}, errors.New("unexpected gpu")
+		}
+		return target, nil
+	case navProcesses:
+		if !hasGPU {
+			return target, nil
+		}
+	case navGPU, navClocks, navECC:
+		if !hasGPU {
+			return navTarget{}, errors.New("missing gpu")
+		}
+	default:
+		return navTarget{}, fmt.Errorf("unknown view %q", view)
+	}
+
+	gpu, err := strconv.Atoi(index)
+	if err != nil || gpu < 0 {
+		return navTarget{}, fmt.Errorf("invalid gpu %q", index)
+	}
+	target.GPU = gpu
+
+	return target, nil
+}
+
+func navButton(text string, target navTarget) gotgbot.InlineKeyboardButton {
+	return gotgbot.InlineKeyboardButton{Text: text, CallbackData: target.data()}
+}
+
+// renderNav renders a view together with the keyboard to move on from it.
+// Views other than the summary may exceed a message and are cut by withSnapshotAge.
+func renderNav(s *Snapshot, target navTarget, procs *ProcFS, now time.Time) (string, gotgbot.InlineKeyboardMarkup, error) {
+	refresh := navButton("Refresh", target)
+
+	if target.View == navSummary || target.View == navProcesses && target.GPU < 0 {
+		var rows [][]gotgbot.InlineKeyboardButton
+		var row []gotgbot.InlineKeyboardButton
+		for _, gpu := range s.GPUs {
+			row = append(row, navButton(fmt.Sprintf("GPU %d", gpu.Index), navTarget{View: navGPU, GPU: gpu.Index}))
+			if len(row) == gpusPerRow {
+				rows, row = append(rows, row), nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+
+		if target.View == navSummary {
+			rows = append(rows, []gotgbot.InlineKeyboardButton{navButton("Processes", navTarget{View: navProcesses, GPU: -1}), refresh})
+			return renderSummaryMessage(s, maxMessageLength-snapshotAgeLength), gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+		}
+
+		rows = append(rows, []gotgbot.InlineKeyboardButton{navButton("« Summary", navTarget{View: navSummary, GPU: -1}), refresh})
+		return renderProcesses(s, procs, now), gotgbot.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+	}
+
+	if target.GPU >= len(s.GPUs) {
+		return "", gotgbot.InlineKeyboardMarkup{}, fmt.Errorf("GPU %d is gone", target.GPU)
+	}
+	gpu := s.GPUs[target.GPU]
+
+	var text string
+	switch target.View {
+	case navGPU:
+		keyboard := gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				navButton("Processes", navTarget{View: navProcesses, GPU: gpu.Index}),
+				navButton("Clocks", navTarget{View: navClocks, GPU: gpu.Index}),
+				navButton("ECC", navTarget{View: navECC, GPU: gpu.Index}),
+			},
+			{navButton("« Summary", navTarget{View: navSummary, GPU: -1}), refresh},
+		}}
+		return renderGPU(gpu), keyboard, nil
+	case navProcesses:
+		text = renderGPUProcesses(gpu, procs, now)
+	case navClocks:
+		text = fmt.Sprintf("<b>%s</b>\nPerformance state: <b>%s</b>\n\n%s", gpuLabel(gpu), gpu.PerformanceState, renderGPUClocks(gpu))
+	case navECC:
+		text = fmt.Sprintf("<b>%s</b>\n%s", gpuLabel(gpu), renderGPUECC(gpu))
+	}
+
+	keyboard := gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+		{navButton(fmt.Sprintf("« GPU %d", gpu.Index), navTarget{View: navGPU, GPU: gpu.Index}), refresh},
+	}}
+	return text, keyboard, nil
+}
+
+// navigate handles the inline keyboard buttons and edits the message they are attached to.
+func navigate(b *gotgbot.Bot, ctx *ext.Context) error {
+	query := ctx.CallbackQuery
+	answer := func(text string) error {
+		_, err := query.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: text})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback query: %w", err)
+		}
+		return nil
+	}
+
+	target, err := parseNavData(query.Data)
+	if err != nil || query.Message == nil {
+		return answer("This button is no longer valid.")
+	}
+
+	var text string
+	var keyboard gotgbot.InlineKeyboardMarkup
+
+	snapshot, err := collector.Collect(context.Background())
+	if err != nil {
+		// The error replaces the view, with a button to try again.
+		log.Println("failed to collect gpu state:", err.Error())
+		text = describeCollectError(err)
+		keyboard.InlineKeyboard = [][]gotgbot.InlineKeyboardButton{{navButton("Retry", target)}}
+	} else {
+		now := time.Now()
+		text, keyboard, err = renderNav(snapshot, target, procFS, now)
+		if err != nil {
+			return answer(err.Error())
+		}
+		text = withSnapshotAge(text, snapshot, now)
+	}
+
+	_, _, err = b.EditMessageText(text, &gotgbot.EditMessageTextOpts{
+		ChatId:      query.Message.GetChat().Id,
+		MessageId:   query.Message.GetMessageId(),
+		ParseMode:   "html",
+		ReplyMarkup: keyboard,
+	})
+	if err != nil && !isMessageNotModified(err) {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	return answer("")
+}
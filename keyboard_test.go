@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNavData(t *testing.T) {
+	valid := []navTarget{
+		{navSummary, -1},
+		{navProcesses, -1},
+		{navProcesses, 1},
+		{navGPU, 0},
+		{navClocks, 12},
+		{navECC, 1},
+	}
+	for _, target := range valid {
+		got, err := parseNavData(target.data())
+		if err != nil || got != target {
+			t.Errorf("parseNavData(%q) = %+v, %v, want %+v", target.data(), got, err, target)
+		}
+	}
+
+	for _, data := range []string{"", "state", "nav:", "nav:state:1", "nav:gpu", "nav:gpu:-1", "nav:gpu:x", "nav:ecc", "nav:fan:0"} {
+		if got, err := parseNavData(data); err == nil {
+			t.Errorf("parseNavData(%q) = %+v, want an error", data, got)
+		}
+	}
+}
+
+func TestRenderNav(t *testing.T) {
+	s := loadFixture(t, "535")
+	now := time.Date(2024, 7, 24, 12, 0, 0, 0, time.UTC)
+
+	targets := []navTarget{{navSummary, -1}, {navProcesses, -1}}
+	for _, gpu := range s.GPUs {
+		for _, view := range []navView{navGPU, navProcesses, navClocks, navECC} {
+			targets = append(targets, navTarget{view, gpu.Index})
+		}
+	}
+
+	for _, target := range targets {
+		text, keyboard, err := renderNav(s, target, testProcFS(), now)
+		if err != nil {
+			t.Fatalf("renderNav(%+v): %v", target, err)
+		}
+		if text == "" || len(text) > maxMessageLength {
+			t.Errorf("renderNav(%+v) text length = %d", target, len(text))
+		}
+
+		var refresh bool
+		for _, row := range keyboard.InlineKeyboard {
+			for _, button := range row {
+				// Telegram rejects callback data longer than 64 bytes.
+				if len(button.CallbackData) > 64 {
+					t.Errorf("renderNav(%+v) button %q data too long", target, button.Text)
+				}
+				if _, err := parseNavData(button.CallbackData); err != nil {
+					t.Errorf("renderNav(%+v) button %q: %v", target, button.Text, err)
+				}
+				refresh = refresh || button.Text == "Refresh" && button.CallbackData == target.data()
+			}
+		}
+		if !refresh {
+			t.Errorf("renderNav(%+v) has no refresh button", target)
+		}
+	}
+
+	if _, _, err := renderNav(s, navTarget{navECC, 2}, testProcFS(), now); err == nil {
+		t.Error("renderNav of a missing GPU succeeded")
+	}
+
+	text, _, _ := renderNav(s, navTarget{navECC, 1}, testProcFS(), now)
+	if !strings.Contains(text, "DRAM uncorrectable") {
+		t.Errorf("ECC view does not show ECC errors:\n%s", text)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	defaultLiveInterval = 30 * time.Second
+	minLiveInterval     = 5 * time.Second
+	defaultLiveTimeout  = time.Hour
+	maxLiveTimeout      = 24 * time.Hour
+
+	// liveFooterLength is reserved at the end of a live message for the update footer.
+	liveFooterLength = 200
+)
+
+// errLiveMessageGone is returned when the live message was deleted or the bot lost access to the chat.
+var errLiveMessageGone = errors.New("live message is gone")
+
+// liveBot is the part of the Telegram API a LiveUpdater needs.
+type liveBot interface {
+	EditMessageText(text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, bool, error)
+	UnpinChatMessage(chatId int64, opts *gotgbot.UnpinChatMessageOpts) (bool, error)
+}
+
+// liveSession is a status message that is kept up to date. Sessions are saved
+// to disk so they are picked up again after a restart.
+type liveSession struct {
+	ChatID    int64         `json:"chat_id"`
+	MessageID int64         `json:"message_id"`
+	Interval  time.Duration `json:"interval"`
+	Until     time.Time     `json:"until"`
+	Pinned    bool          `json:"pinned"`
+
+	stop chan struct{}
+}
+
+// LiveUpdater keeps live status messages up to date, one per chat.
+type LiveUpdater struct {
+	store     *Store
+	collector Collector
+	// after is time.After, replaceable in tests.
+	after func(time.Duration) <-chan time.Time
+
+	mu       sync.Mutex
+	sessions map[int64]*liveSession
+}
+
+// liveSessionsKey is where the store keeps the live sessions.
+const liveSessionsKey = "live"
+
+// NewLiveUpdater creates a LiveUpdater that saves its sessions in the store.
+func NewLiveUpdater(store *Store, collector Collector) *LiveUpdater {
+	return &LiveUpdater{
+		store:     store,
+		collector: collector,
+		after:     time.After,
+		sessions:  make(map[int64]*liveSession),
+	}
+}
+
+// Start begins updating a message, replacing the live message previously running in the same chat.
+func (l *LiveUpdater) Start(bot liveBot, session *liveSession) {
+	session.stop = make(chan struct{})
+
+	l.mu.Lock()
+	if previous, ok := l.sessions[session.ChatID]; ok {
+		close(previous.stop)
+	}
+	l.sessions[session.ChatID] = session
+	l.saveLocked()
+	l.mu.Unlock()
+
+	go l.run(bot, session)
+}
+
+// Stop stops the live message in a chat and reports whether there was one.
+func (l *LiveUpdater) Stop(chatID int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	session, ok := l.sessions[chatID]
+	if !ok {
+		return false
+	}
+	close(session.stop)
+	delete(l.sessions, chatID)
+	l.saveLocked()
+
+	return true
+}
+
+// Resume restarts the sessions saved by a previous run of the bot.
+func (l *LiveUpdater) Resume(bot liveBot) error {
+	var sessions []*liveSession
+	if _, err := l.store.Load(liveSessionsKey, &sessions); err != nil {
+		return fmt.Errorf("failed to load live sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		l.Start(bot, session)
+	}
+
+	return nil
+}
+
+func (l *LiveUpdater) run(bot liveBot, session *liveSession) {
+	for {
+		if !time.Now().Before(session.Until) {
+			l.finish(bot, session, "Live updates timed out.")
+			return
+		}
+
+		err := l.update(bot, session)
+		if errors.Is(err, errLiveMessageGone) {
+			l.remove(session)
+			return
+		}
+		if err != nil {
+			log.Println("failed to update live message:", err.Error())
+		}
+
+		select {
+		case <-session.stop:
+			l.finish(bot, session, "Live updates stopped.")
+			return
+		case <-l.after(session.Interval):
+		}
+	}
+}
+
+// update edits the live message with a fresh snapshot, waiting out rate limits.
+func (l *LiveUpdater) update(bot liveBot, session *liveSession) error {
+	snapshot, err := l.collector.Collect(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to collect gpu state: %w", err)
+	}
+
+	return l.edit(bot, session, renderLive(snapshot, session, time.Now()))
+}
+
+func (l *LiveUpdater) edit(bot liveBot, session *liveSession, text string) error {
+	for {
+		_, _, err := bot.EditMessageText(text, &gotgbot.EditMessageTextOpts{
+			ChatId:    session.ChatID,
+			MessageId: session.MessageID,
+			ParseMode: "html",
+		})
+
+		var tgErr *gotgbot.TelegramError
+		if err == nil || !errors.As(err, &tgErr) {
+			return err
+		}
+
+		switch {
+		case isMessageNotModified(err):
+			return nil
+		case tgErr.Code == 429 && tgErr.ResponseParams != nil:
+			select {
+			case <-session.stop:
+				return nil
+			case <-l.after(time.Duration(tgErr.ResponseParams.RetryAfter) * time.Second):
+			}
+		case tgErr.Code == 403 || strings.Contains(tgErr.Description, "message to edit not found"):
+			return errLiveMessageGone
+		default:
+			return err
+		}
+	}
+}
+
+// isMessageNotModified reports whether an edit failed only because the new text equals the old one.
+func isMessageNotModified(err error) bool {
+	var tgErr *gotgbot.TelegramError
+	return errors.As(err, &tgErr) && strings.Contains(tgErr.Description, "message is not modified")
+}
+
+// finish marks the live message as no longer updated and unpins it.
+func (l *LiveUpdater) finish(bot liveBot, session *liveSession, reason string) {
+	l.remove(session)
+
+	snapshot, err := l.collector.Collect(context.Background())
+	if err == nil {
+		err = l.edit(bot, session, renderLive(snapshot, nil, time.Now())+"\n<i>"+reason+"</i>")
+	}
+	if err != nil {
+		log.Println("failed to finish live message:", err.Error())
+	}
+
+	if session.Pinned {
+		_, err := bot.UnpinChatMessage(session.ChatID, &gotgbot.UnpinChatMessageOpts{MessageId: &session.MessageID})
+		if err != nil {
+			log.Println("failed to unpin live message:", err.Error())
+		}
+	}
+}
+
+// remove forgets a session unless it has already been replaced by a newer one.
+func (l *LiveUpdater) remove(session *liveSession) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sessions[session.ChatID] == session {
+		delete(l.sessions, session.ChatID)
+		l.saveLocked()
+	}
+}
+
+func (l *LiveUpdater) saveLocked() {
+	sessions := make([]*liveSession, 0, len(l.sessions))
+	for _, session := range l.sessions {
+		sessions = append(sessions, session)
+	}
+
+	if err := l.store.Save(liveSessionsKey, sessions); err != nil {
+		log.Println("failed to save live sessions:", err.Error())
+	}
+}
+
+// renderLive renders the summary table with a footer telling when the snapshot was taken.
+// A nil session renders the final state of a finished live message.
+func renderLive(s *Snapshot, session *liveSession, now time.Time) string {
+	text := renderSummaryMessage(s, maxMessageLength-liveFooterLength)
+	updated := s.CollectedAt.In(now.Location()).Format("15:04:05")
+
+	if session == nil {
+		return text + fmt.Sprintf("\n<i>Updated %s</i>", updated)
+	}
+
+	return text + fmt.Sprintf("\n<i>Updated %s, every %s until %s</i>", updated, session.Interval, session.Until.In(now.Location()).Format("15:04"))
+}
+
+// parseLiveArgs parses the arguments of /live: an optional update interval,
+// an optional timeout and the "pin" flag, in any order.
+func parseLiveArgs(args []string) (interval, timeout time.Duration, pin bool, err error) {
+	var durations []time.Duration
+	for _, arg := range args {
+		if arg == "pin" {
+			pin = true
+			continue
+		}
+
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("unknown argument %q", arg)
+		}
+		durations = append(durations, d)
+	}
+
+	interval, timeout = defaultLiveInterval, defaultLiveTimeout
+	switch len(durations) {
+	case 2:
+		timeout = durations[1]
+		fallthrough
+	case 1:
+		interval = durations[0]
+	case 0:
+	default:
+		return 0, 0, false, errors.New("too many durations")
+	}
+
+	if interval < minLiveInterval {
+		return 0, 0, false, fmt.Errorf("the interval must be at least %s", minLiveInterval)
+	}
+	if timeout <= 0 {
+		return 0, 0, false, errors.New("the timeout must be positive")
+	}
+	if timeout < interval {
+		return 0, 0, false, fmt.Errorf("the timeout must be at least the interval of %s", interval)
+	}
+	if timeout > maxLiveTimeout {
+		return 0, 0, false, fmt.Errorf("the timeout must be at most %s", maxLiveTimeout)
+	}
+
+	return interval, timeout, pin, nil
+}
+
+var liveUpdater *LiveUpdater
+
+// live handles /live [interval] [timeout] [pin] and /live stop.
+func live(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+	if len(args) == 1 && args[0] == "stop" {
+		reply := "There is no live status in this chat."
+		if liveUpdater.Stop(ctx.EffectiveChat.Id) {
+			reply = "Live status stopped."
+		}
+
+		_, err := ctx.EffectiveMessage.Reply(b, reply, nil)
+		if err != nil {
+			return fmt.Errorf("failed to send live stop message: %w", err)
+		}
+		return nil
+	}
+
+	interval, timeout, pin, err := parseLiveArgs(args)
+	if err != nil {
+		_, err := ctx.EffectiveMessage.Reply(b, fmt.Sprintf("%s.\nUsage: /live [interval] [timeout] [pin], e.g. /live 30s 2h pin, or /live stop", err), nil)
+		if err != nil {
+			return fmt.Errorf("failed to send live usage message: %w", err)
+		}
+		return nil
+	}
+
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+
+	session := &liveSession{
+		ChatID:   ctx.EffectiveChat.Id,
+		Interval: interval,
+		Until:    time.Now().Add(timeout),
+	}
+	message, err := b.SendMessage(session.ChatID, renderLive(snapshot, session, time.Now()), &gotgbot.SendMessageOpts{
+		ParseMode: "html",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send live message: %w", err)
+	}
+	session.MessageID = message.MessageId
+
+	if pin {
+		_, err := b.PinChatMessage(session.ChatID, session.MessageID, &gotgbot.PinChatMessageOpts{DisableNotification: true})
+		if err != nil {
+			log.Println("failed to pin live message:", err.Error())
+		} else {
+			session.Pinned = true
+		}
+	}
+
+	liveUpdater.Start(b, session)
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+type staticCollector struct {
+	snapshot *Snapshot
+}
+
+func (c staticCollector) Collect(ctx context.Context) (*Snapshot, error) {
+	return c.snapshot, nil
+}
+
+// fakeLiveBot records edits and fails them with the queued errors first.
+type fakeLiveBot struct {
+	mu       sync.Mutex
+	errs     []error
+	edits    []string
+	unpinned []int64
+}
+
+func (f *fakeLiveBot) EditMessageText(text string, opts *gotgbot.EditMessageTextOpts) (*gotgbot.Message, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, false, err
+	}
+	f.edits = append(f.edits, text)
+	return nil, true, nil
+}
+
+func (f *fakeLiveBot) UnpinChatMessage(chatId int64, opts *gotgbot.UnpinChatMessageOpts) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.unpinned = append(f.unpinned, *opts.MessageId)
+	return true, nil
+}
+
+func newTestLiveUpdater(t *testing.T) (*LiveUpdater, *[]time.Duration) {
+	l := NewLiveUpdater(testStore(t), staticCollector{loadFixture(t, "555")})
+
+	var waits []time.Duration
+	l.after = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+
+	return l, &waits
+}
+
+func TestLiveEditHandlesTelegramErrors(t *testing.T) {
+	l, waits := newTestLiveUpdater(t)
+	session := &liveSession{ChatID: 1, MessageID: 2, stop: make(chan struct{})}
+
+	bot := &fakeLiveBot{errs: []error{
+		&gotgbot.TelegramError{Code: 429, Description: "Too Many Requests: retry after 7", ResponseParams: &gotgbot.ResponseParameters{RetryAfter: 7}},
+	}}
+	if err := l.edit(bot, session, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if len(bot.edits) != 1 || len(*waits) != 1 || (*waits)[0] != 7*time.Second {
+		t.Errorf("expected a retry after 7s, got edits %v, waits %v", bot.edits, *waits)
+	}
+
+	bot = &fakeLiveBot{errs: []error{
+		&gotgbot.TelegramError{Code: 400, Description: "Bad Request: message is not modified: specified new message content and reply markup are exactly the same"},
+	}}
+	if err := l.edit(bot, session, "text"); err != nil {
+		t.Errorf("message is not modified: err = %v, want nil", err)
+	}
+
+	bot = &fakeLiveBot{errs: []error{
+		&gotgbot.TelegramError{Code: 400, Description: "Bad Request: message to edit not found"},
+	}}
+	if err := l.edit(bot, session, "text"); !errors.Is(err, errLiveMessageGone) {
+		t.Errorf("deleted message: err = %v, want errLiveMessageGone", err)
+	}
+}
+
+func TestLiveSessionsSurviveRestart(t *testing.T) {
+	l, _ := newTestLiveUpdater(t)
+	bot := &fakeLiveBot{}
+
+	// A long interval keeps the session running while it is saved.
+	l.after = func(time.Duration) <-chan time.Time { return nil }
+	l.Start(bot, &liveSession{ChatID: 1, MessageID: 10, Interval: time.Hour, Until: time.Now().Add(time.Hour)})
+	l.Start(bot, &liveSession{ChatID: 2, MessageID: 20, Interval: time.Hour, Until: time.Now().Add(-time.Minute), Pinned: true})
+
+	restarted := NewLiveUpdater(l.store, l.collector)
+	restarted.after = l.after
+	bot = &fakeLiveBot{}
+	if err := restarted.Resume(bot); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		restarted.mu.Lock()
+		_, active := restarted.sessions[1]
+		_, expired := restarted.sessions[2]
+		restarted.mu.Unlock()
+
+		bot.mu.Lock()
+		unpinned := len(bot.unpinned)
+		bot.mu.Unlock()
+
+		if active && !expired && unpinned == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sessions after restart: active %v, expired %v, unpinned %d", active, expired, unpinned)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !restarted.Stop(1) {
+		t.Error("expected the resumed session to be stoppable")
+	}
+}
+
+func TestParseLiveArgs(t *testing.T) {
+	interval, timeout, pin, err := parseLiveArgs([]string{"10s", "pin", "2h"})
+	if err != nil || interval != 10*time.Second || timeout != 2*time.Hour || !pin {
+		t.Errorf("parseLiveArgs = %v, %v, %v, %v", interval, timeout, pin, err)
+	}
+
+	interval, timeout, pin, err = parseLiveArgs(nil)
+	if err != nil || interval != defaultLiveInterval || timeout != defaultLiveTimeout || pin {
+		t.Errorf("defaults = %v, %v, %v, %v", interval, timeout, pin, err)
+	}
+
+	for _, args := range [][]string{{"1s"}, {"10s", "48h"}, {"soon"}, {"10s", "1h", "2h"}, {"30s", "0s"}, {"30s", "-1h"}, {"10m", "5m"}, {"2h"}} {
+		if _, _, _, err := parseLiveArgs(args); err == nil {
+			t.Errorf("parseLiveArgs(%v): expected an error", args)
+		}
+	}
+}
+
+func TestRenderLive(t *testing.T) {
+	now := time.Date(2024, 7, 24, 15, 34, 38, 0, time.UTC)
+	session := &liveSession{Interval: 30 * time.Second, Until: now.Add(time.Hour)}
+
+	text := renderLive(loadFixture(t, "555"), session, now)
+	if !strings.HasSuffix(text, "<i>Updated 15:34:38, every 30s until 16:34</i>") {
+		t.Errorf("unexpected footer:\n%s", text)
+	}
+}
@@ -1,44 +1,84 @@
 package main
 
 import (
-	"bytes"
-	"encoding/xml"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"html"
 	"log"
+	"maps"
 	"os"
-	"os/exec"
-	"strconv"
+	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
 )
 
-var chatID int64
+var (
+	// settings is the current configuration, replaced on SIGHUP.
+	settings atomic.Pointer[Settings]
+	// collectorSwitch is replaced when the collector settings change; everything else uses the cached collector.
+	collectorSwitch = NewSwitchCollector(NewNvidiaSmiCollector())
+	collector       = NewCachedCollector(collectorSwitch, defaultSnapshotMaxAge)
+	// store keeps what must survive a restart; it is nil when the database cannot be opened.
+	store *Store
+)
 
 func main() {
-	var (
-		err              error
-		token, envChatID string
-	)
+	configPath := flag.String("config", os.Getenv("CONFIG"), "path to the YAML configuration file; without it the bot is configured from environment variables")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration, report every problem and exit")
+	flag.Parse()
 
-	token = os.Getenv("TOKEN")
-	if token == "" {
-		panic("TOKEN environment variable is empty")
+	current, err := loadConfig(*configPath)
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid config:\n"+err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("config is valid")
+		return
 	}
-
-	envChatID = os.Getenv("CHAT_ID")
-	if envChatID == "" {
-		panic("CHAT_ID environment variable is empty")
+	if err != nil {
+		panic("invalid config: " + err.Error())
 	}
-	chatID, err = strconv.ParseInt(envChatID, 10, 64)
+	settings.Store(current)
+
+	c, err := newCollector(current)
 	if err != nil {
-		panic("failed to parse CHAT_ID: ")
+		panic("failed to create collector: " + err.Error())
+	}
+	collectorSwitch.Set(c)
+	collector.SetMaxAge(current.SnapshotMaxAge)
+	if current.Fixtures != "" {
+		log.Printf("replaying nvidia-smi output from %s\n", current.Fixtures)
 	}
 
-	b, err := gotgbot.NewBot(token, nil)
+	// Without the database the bot still runs, it only forgets everything on restart.
+	if store, err = OpenStore(current.StateDir); err != nil {
+		log.Println("running without persistence:", err.Error())
+	}
+	history = NewHistory(current.HistoryTiers, current.AlertInterval)
+	if err := history.Restore(store, time.Now()); err != nil {
+		log.Println(err.Error())
+	}
+	usage = NewProcessUsage(current.AlertInterval, history.Retention(), procFS)
+	if err := usage.Restore(store, time.Now()); err != nil {
+		log.Println("failed to load gpu usage:", err.Error())
+	}
+	idleOptOuts = NewIdleOptOuts(store)
+	freeWatcher = NewFreeWatcher(store)
+	pidWatcher = NewPIDWatcher(procFS, store)
+	liveUpdater = NewLiveUpdater(store, collector)
+
+	b, err := gotgbot.NewBot(current.Token, nil)
 	if err != nil {
 		panic("failed to create new bot: " + err.Error())
 	}
@@ -52,16 +92,34 @@ func main() {
 	})
 	updater := ext.NewUpdater(dispatcher, nil)
 
-	dispatcher.AddHandler(handlers.NewCommand("start", start))
-	dispatcher.AddHandler(handlers.NewCommand("state", state))
-	dispatcher.AddHandler(handlers.NewCommand("chat_id", showChatID))
+	// The access middleware runs before every other handler group.
+	access := &Access{ACL: func() *ACL { return settings.Load().ACL }}
+	dispatcher.AddHandlerToGroup(access, -1)
+
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("start", start))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("state", state))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("gpu", gpuDetails))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("processes", processes))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("history", historyChart))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("report", report))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("idle_optout", idleOptOut))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("idle_optin", idleOptOut))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("notify_free", notifyFree))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("notify_list", notifyList))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("notify_cancel", notifyCancel))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("watch_pid", watchPID))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("health", health))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("pcie", pcie))
+	access.Handle(dispatcher, RoleOperator, handlers.NewCommand("live", live))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCommand("chat_id", showChatID))
+	access.Handle(dispatcher, RoleViewer, handlers.NewCallback(callbackquery.Prefix(navPrefix), navigate))
 
 	err = updater.StartPolling(b, &ext.PollingOpts{
 		DropPendingUpdates: true,
 		GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
-			Timeout: 9,
+			Timeout: int64(current.PollingTimeout / time.Second),
 			RequestOpts: &gotgbot.RequestOpts{
-				Timeout: time.Second * 10,
+				Timeout: current.PollingRequestTimeout,
 			},
 		},
 	})
@@ -70,9 +128,170 @@ func main() {
 	}
 	log.Printf("%s has been started...\n", b.User.Username)
 
+	if err := liveUpdater.Resume(b); err != nil {
+		log.Println("failed to resume live messages:", err.Error())
+	}
+
+	if current.MetricsListen != "" {
+		go serveMetrics(current.MetricsListen, &Exporter{Collector: collector, Host: current.MetricsHost})
+	}
+
+	poller := &Poller{
+		Collector: collector,
+		Observers: observers,
+		Send: func(alert Alert) {
+			sendAlert(b, alert)
+		},
+	}
+	poller.Apply(current)
+
+	reporter := &Reporter{
+		Send: func(alert Alert) {
+			sendAlert(b, alert)
+		},
+	}
+	reporter.Apply(current.Reports)
+
+	xidWatcher := &XidWatcher{
+		Send: func(alert Alert) {
+			sendAlert(b, alert)
+		},
+		Collect: collector.Collect,
+	}
+	xidWatcher.Apply(current.XidSource)
+
+	if *configPath != "" {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		go func() {
+			for range hangup {
+				reload(*configPath, poller, reporter, xidWatcher)
+			}
+		}()
+	}
+
 	updater.Idle()
 }
 
+// observers returns the observers the poller feeds with every snapshot.
+func observers(s *Settings) []Observer {
+	var observers []Observer
+	if history != nil {
+		observers = append(observers, history)
+	}
+	if usage != nil {
+		observers = append(observers, usage)
+	}
+	if freeWatcher != nil {
+		observers = append(observers, freeWatcher)
+	}
+	if pidWatcher != nil {
+		observers = append(observers, pidWatcher)
+	}
+	observers = append(observers, NewHealthMonitor(store), NewPCIeMonitor(s.MaxReplaysPerHour, store))
+	if len(s.AlertRules) > 0 {
+		observers = append(observers, NewThresholdAlerter(s.AlertRules, store))
+	}
+	if s.ThrottleDuration > 0 {
+		observers = append(observers, NewThrottleDetector(s.ThrottleDuration, s.ThrottleIgnorePowerCap, store))
+	}
+	if s.IdleWindow > 0 {
+		observers = append(observers, NewIdleDetector(s, procFS, idleOptOuts, store))
+	}
+
+	return observers
+}
+
+// pollerChanged reports whether the poller must be restarted to apply next.
+func pollerChanged(previous, next *Settings) bool {
+	return previous.AlertInterval != next.AlertInterval || !slices.Equal(previous.AlertRules, next.AlertRules) ||
+		previous.ThrottleDuration != next.ThrottleDuration || previous.ThrottleIgnorePowerCap != next.ThrottleIgnorePowerCap ||
+		previous.MaxReplaysPerHour != next.MaxReplaysPerHour ||
+		previous.IdleWindow != next.IdleWindow || previous.IdleMinMemory != next.IdleMinMemory ||
+		!slices.Equal(previous.IdleAllowUsers, next.IdleAllowUsers) || !slices.Equal(previous.IdleAllowProcesses, next.IdleAllowProcesses) ||
+		!maps.Equal(previous.UnixUsers, next.UnixUsers)
+}
+
+// reload applies the configuration file again without interrupting the Telegram session.
+// An invalid file is ignored, and settings only read at startup keep their current values.
+func reload(path string, poller *Poller, reporter *Reporter, xidWatcher *XidWatcher) {
+	next, err := loadConfig(path)
+	if err != nil {
+		log.Println("failed to reload config, keeping the current one:", strings.ReplaceAll(err.Error(), "\n", "; "))
+		return
+	}
+	previous := settings.Load()
+
+	// Settings that take effect after a restart keep their current values, and every one that changed is logged.
+	var ignored []string
+	keep := func(name string, changed bool, restore func()) {
+		if changed {
+			ignored = append(ignored, name)
+			restore()
+		}
+	}
+	keep("token", next.Token != previous.Token, func() { next.Token = previous.Token })
+	keep("state_dir", next.StateDir != previous.StateDir, func() { next.StateDir = previous.StateDir })
+	keep("polling.timeout", next.PollingTimeout != previous.PollingTimeout, func() { next.PollingTimeout = previous.PollingTimeout })
+	keep("polling.request_timeout", next.PollingRequestTimeout != previous.PollingRequestTimeout, func() { next.PollingRequestTimeout = previous.PollingRequestTimeout })
+	keep("metrics.listen", next.MetricsListen != previous.MetricsListen, func() { next.MetricsListen = previous.MetricsListen })
+	keep("metrics.host", next.MetricsHost != previous.MetricsHost, func() { next.MetricsHost = previous.MetricsHost })
+	keep("history", !slices.Equal(next.HistoryTiers, previous.HistoryTiers), func() { next.HistoryTiers = previous.HistoryTiers })
+	if len(ignored) > 0 {
+		log.Printf("%s changed and take effect after a restart\n", strings.Join(ignored, ", "))
+	}
+
+	// The poller applies the new interval below; the history and the GPU usage sample at it from now on.
+	if next.AlertInterval != previous.AlertInterval {
+		history.SetInterval(next.AlertInterval)
+		usage.SetInterval(next.AlertInterval)
+	}
+
+	if next.NvidiaSmi != previous.NvidiaSmi || next.NvidiaSmiTimeout != previous.NvidiaSmiTimeout || next.Fixtures != previous.Fixtures {
+		c, err := newCollector(next)
+		if err != nil {
+			log.Println("failed to create collector, keeping the current one:", err.Error())
+			next.NvidiaSmi, next.NvidiaSmiTimeout, next.Fixtures = previous.NvidiaSmi, previous.NvidiaSmiTimeout, previous.Fixtures
+		} else {
+			collectorSwitch.Set(c)
+			collector.Forget()
+		}
+	}
+	collector.SetMaxAge(next.SnapshotMaxAge)
+
+	settings.Store(next)
+	if pollerChanged(previous, next) {
+		poller.Apply(next)
+	}
+	if !slices.EqualFunc(previous.Reports, next.Reports, func(a, b ReportSchedule) bool { return a.Spec == b.Spec && a.Range == b.Range }) {
+		reporter.Apply(next.Reports)
+	}
+	if next.XidSource != previous.XidSource {
+		xidWatcher.Apply(next.XidSource)
+	}
+
+	log.Println("config reloaded")
+}
+
+// sendAlert sends an alert to its chat or to every chat in the ACL whose members may all see the GPU state.
+func sendAlert(b *gotgbot.Bot, alert Alert) {
+	chats := settings.Load().ACL.AlertChats()
+	if alert.ChatID != 0 {
+		chats = []int64{alert.ChatID}
+	}
+
+	for _, chatID := range chats {
+		opts := &gotgbot.SendMessageOpts{ParseMode: "html"}
+		if alert.ReplyTo != 0 {
+			opts.ReplyParameters = &gotgbot.ReplyParameters{MessageId: alert.ReplyTo, AllowSendingWithoutReply: true}
+		}
+		_, err := b.SendMessage(chatID, alert.Text, opts)
+		if err != nil {
+			log.Println("failed to send an alert:", err.Error())
+		}
+	}
+}
+
 func start(b *gotgbot.Bot, ctx *ext.Context) error {
 	_, err := ctx.EffectiveMessage.Reply(b, fmt.Sprintf("Hello, I'm @%s. I <b>send</b> information about GPU state on a server where I am connected to.", b.User.Username), &gotgbot.SendMessageOpts{
 		ParseMode: "html",
@@ -94,80 +313,86 @@ func showChatID(b *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func state(b *gotgbot.Bot, ctx *ext.Context) error {
-	if chatID != ctx.Message.Chat.Id {
-		_, err := ctx.EffectiveMessage.Reply(b, "Sorry this bot is gated", &gotgbot.SendMessageOpts{
-			ParseMode: "html",
-		})
-		if err != nil {
-			return fmt.Errorf("failed to send no nvidia-smi binary message: %w", err)
-		}
-
-		return nil
+// collectSnapshot collects a snapshot for a command. It returns a nil snapshot
+// without an error when the user has already been told why there is none.
+func collectSnapshot(b *gotgbot.Bot, ctx *ext.Context) (*Snapshot, error) {
+	snapshot, err := collector.Collect(context.Background())
+	if err == nil {
+		return snapshot, nil
 	}
+	log.Println("failed to collect gpu state:", err.Error())
 
-	if _, err := exec.LookPath("nvidia-smi"); err != nil {
-		_, err := ctx.EffectiveMessage.Reply(b, "No nvidia-smi binary", &gotgbot.SendMessageOpts{
-			ParseMode: "html",
-		})
-		if err != nil {
-			return fmt.Errorf("failed to send no nvidia-smi binary message: %w", err)
-		}
+	_, err = ctx.EffectiveMessage.Reply(b, describeCollectError(err), &gotgbot.SendMessageOpts{
+		ParseMode: "html",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send collect error message: %w", err)
 	}
 
-	cmd := exec.Command("nvidia-smi", "-q", "-x")
+	return nil, nil
+}
 
-	var outb, errb bytes.Buffer
-	cmd.Stdout = &outb
-	cmd.Stderr = &errb
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to run nvidia-smi: %w", err)
-	}
-	if len(errb.String()) > 0 {
-		return fmt.Errorf("nvidia-smi error: %s", errb.String())
+// describeCollectError explains to the user why there is no GPU state.
+func describeCollectError(err error) string {
+	var exitErr *NvidiaSmiExitError
+	switch {
+	case errors.Is(err, ErrNoNvidiaSmi):
+		return "No nvidia-smi binary: it is not installed or not in PATH."
+	case errors.Is(err, ErrDriverNotLoaded):
+		return "The NVIDIA driver is not loaded, nvidia-smi cannot talk to it."
+	case errors.Is(err, ErrNvidiaSmiTimeout):
+		return "nvidia-smi did not answer in time and was killed. The driver may be hung, check <code>dmesg</code> for Xid errors."
+	case errors.As(err, &exitErr):
+		return fmt.Sprintf("nvidia-smi failed with exit code %d:\n<pre>%s</pre>", exitErr.Code, html.EscapeString(truncateMessage(exitErr.Output, 1000)))
+	case errors.Is(err, ErrMalformedXML):
+		return "nvidia-smi returned output that is not valid XML:\n<pre>" + html.EscapeString(err.Error()) + "</pre>"
 	}
 
-	var results NvidiaSmiLog
-	err = xml.Unmarshal(outb.Bytes(), &results)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal xml: %w", err)
-	}
+	return "Failed to get the GPU state:\n<pre>" + html.EscapeString(err.Error()) + "</pre>"
+}
 
-	var info []string = []string{
-		fmt.Sprintf("Timestamp: <b>%s</b>", results.Timestamp),
-		fmt.Sprintf("Driver Version: <b>%s</b>", results.DriverVersion),
-		fmt.Sprintf("CUDA Version: <b>%s</b>", results.CudaVersion),
-		fmt.Sprintf("Attached GPUs: <b>%s</b>", results.AttachedGpus),
+func state(b *gotgbot.Bot, ctx *ext.Context) error {
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
 	}
 
-	_, err = b.SendMessage(ctx.Message.Chat.Id, strings.Join(info, "\n"), &gotgbot.SendMessageOpts{
-		ParseMode: "html",
-	})
-	if err != nil {
-		return fmt.Errorf("failed to send a message: %w", err)
-	}
-
-	for _, gpuInfo := range results.Gpu {
-		var fullGpuInfo []string = []string{
-			fmt.Sprintf("GPU ID: <b>%s</b>", gpuInfo.ID),
-			fmt.Sprintf("Product Name: <b>%s</b> (%s)", gpuInfo.ProductName, gpuInfo.ProductArchitecture),
-			fmt.Sprintf("Fan speed: <b>%s</b>", gpuInfo.FanSpeed),
-			"",
-			fmt.Sprintf("Memory total: <b>%s</b>", gpuInfo.FbMemoryUsage.Total),
-			fmt.Sprintf("Memory reserved: <b>%s</b>", gpuInfo.FbMemoryUsage.Reserved),
-			fmt.Sprintf("Memory used: <b>%s</b>", gpuInfo.FbMemoryUsage.Used),
-			fmt.Sprintf("Memory free: <b>%s</b>", gpuInfo.FbMemoryUsage.Free),
-			"",
-			fmt.Sprintf("GPU utilization: <b>%s</b>", gpuInfo.Utilization.GpuUtil),
-			fmt.Sprintf("Memory utilization: <b>%s</b>", gpuInfo.Utilization.MemoryUtil),
-			"",
-			fmt.Sprintf("GPU temperature: <b>%s</b>", gpuInfo.Temperature.GpuTemp),
-			// fmt.Sprintf("GPU temperature (max threshold): <b>%s</b>", gpuInfo.Temperature.GpuTempMaxThreshold),
-			fmt.Sprintf("GPU power draw: <b>%s</b> / <b>%s</b>", gpuInfo.GpuPowerReadings.PowerDraw, gpuInfo.GpuPowerReadings.CurrentPowerLimit),
+	now := time.Now()
+
+	var messages []string
+	switch args := ctx.Args(); {
+	case len(args) < 2 && settings.Load().FullState:
+		messages = renderState(snapshot)
+	case len(args) < 2:
+		// The keyboard goes on the last message; its buttons replace that message with a view that fits in one.
+		_, keyboard, _ := renderNav(snapshot, navTarget{View: navSummary, GPU: -1}, procFS, now)
+		messages = renderSummaryLimit(snapshot, maxMessageLength-snapshotAgeLength)
+		messages[len(messages)-1] = withSnapshotAge(messages[len(messages)-1], snapshot, now)
+		for i, message := range messages {
+			opts := &gotgbot.SendMessageOpts{ParseMode: "html"}
+			if i == len(messages)-1 {
+				opts.ReplyMarkup = keyboard
+			}
+			if _, err := b.SendMessage(ctx.EffectiveChat.Id, message, opts); err != nil {
+				return fmt.Errorf("failed to send a message: %w", err)
+			}
+		}
+		return nil
+	case args[1] == "summary":
+		messages = renderSummaryLimit(snapshot, maxMessageLength-snapshotAgeLength)
+	case args[1] == "full":
+		messages = renderState(snapshot)
+	default:
+		_, err := ctx.EffectiveMessage.Reply(b, "Usage: /state [full|summary]", nil)
+		if err != nil {
+			return fmt.Errorf("failed to send state usage message: %w", err)
 		}
+		return nil
+	}
+	messages[len(messages)-1] = withSnapshotAge(messages[len(messages)-1], snapshot, now)
 
-		_, err = b.SendMessage(ctx.Message.Chat.Id, strings.Join(fullGpuInfo, "\n"), &gotgbot.SendMessageOpts{
+	for _, message := range messages {
+		_, err = b.SendMessage(ctx.EffectiveChat.Id, message, &gotgbot.SendMessageOpts{
 			ParseMode: "html",
 		})
 		if err != nil {
@@ -177,355 +402,3 @@ func state(b *gotgbot.Bot, ctx *ext.Context) error {
 
 	return nil
 }
-
-// NvidiaSmiLog was generated 2024-07-24 14:58:41 by https://xml-to-go.github.io/ in Ukraine.
-type NvidiaSmiLog struct {
-	XMLName       xml.Name `xml:"nvidia_smi_log"`
-	Text          string   `xml:",chardata"`
-	Timestamp     string   `xml:"timestamp"`
-	DriverVersion string   `xml:"driver_version"`
-	CudaVersion   string   `xml:"cuda_version"`
-	AttachedGpus  string   `xml:"attached_gpus"`
-	Gpu           []struct {
-		Text                string `xml:",chardata"`
-		ID                  string `xml:"id,attr"`
-		ProductName         string `xml:"product_name"`
-		ProductBrand        string `xml:"product_brand"`
-		ProductArchitecture string `xml:"product_architecture"`
-		DisplayMode         string `xml:"display_mode"`
-		DisplayActive       string `xml:"display_active"`
-		PersistenceMode     string `xml:"persistence_mode"`
-		AddressingMode      string `xml:"addressing_mode"`
-		MigMode             struct {
-			Text       string `xml:",chardata"`
-			CurrentMig string `xml:"current_mig"`
-			PendingMig string `xml:"pending_mig"`
-		} `xml:"mig_mode"`
-		MigDevices               string `xml:"mig_devices"`
-		AccountingMode           string `xml:"accounting_mode"`
-		AccountingModeBufferSize string `xml:"accounting_mode_buffer_size"`
-		DriverModel              struct {
-			Text      string `xml:",chardata"`
-			CurrentDm string `xml:"current_dm"`
-			PendingDm string `xml:"pending_dm"`
-		} `xml:"driver_model"`
-		Serial           string `xml:"serial"`
-		Uuid             string `xml:"uuid"`
-		MinorNumber      string `xml:"minor_number"`
-		VbiosVersion     string `xml:"vbios_version"`
-		MultigpuBoard    string `xml:"multigpu_board"`
-		BoardID          string `xml:"board_id"`
-		BoardPartNumber  string `xml:"board_part_number"`
-		GpuPartNumber    string `xml:"gpu_part_number"`
-		GpuFruPartNumber string `xml:"gpu_fru_part_number"`
-		GpuModuleID      string `xml:"gpu_module_id"`
-		InforomVersion   struct {
-			Text       string `xml:",chardata"`
-			ImgVersion string `xml:"img_version"`
-			OemObject  string `xml:"oem_object"`
-			EccObject  string `xml:"ecc_object"`
-			PwrObject  string `xml:"pwr_object"`
-		} `xml:"inforom_version"`
-		InforomBbxFlush struct {
-			Text            string `xml:",chardata"`
-			LatestTimestamp string `xml:"latest_timestamp"`
-			LatestDuration  string `xml:"latest_duration"`
-		} `xml:"inforom_bbx_flush"`
-		GpuOperationMode struct {
-			Text       string `xml:",chardata"`
-			CurrentGom string `xml:"current_gom"`
-			PendingGom string `xml:"pending_gom"`
-		} `xml:"gpu_operation_mode"`
-		C2cMode               string `xml:"c2c_mode"`
-		GpuVirtualizationMode struct {
-			Text                  string `xml:",chardata"`
-			VirtualizationMode    string `xml:"virtualization_mode"`
-			HostVgpuMode          string `xml:"host_vgpu_mode"`
-			VgpuHeterogeneousMode string `xml:"vgpu_heterogeneous_mode"`
-		} `xml:"gpu_virtualization_mode"`
-		GpuResetStatus struct {
-			Text                     string `xml:",chardata"`
-			ResetRequired            string `xml:"reset_required"`
-			DrainAndResetRecommended string `xml:"drain_and_reset_recommended"`
-		} `xml:"gpu_reset_status"`
-		GspFirmwareVersion string `xml:"gsp_firmware_version"`
-		Ibmnpu             struct {
-			Text                string `xml:",chardata"`
-			RelaxedOrderingMode string `xml:"relaxed_ordering_mode"`
-		} `xml:"ibmnpu"`
-		Pci struct {
-			Text           string `xml:",chardata"`
-			PciBus         string `xml:"pci_bus"`
-			PciDevice      string `xml:"pci_device"`
-			PciDomain      string `xml:"pci_domain"`
-			PciBaseClass   string `xml:"pci_base_class"`
-			PciSubClass    string `xml:"pci_sub_class"`
-			PciDeviceID    string `xml:"pci_device_id"`
-			PciBusID       string `xml:"pci_bus_id"`
-			PciSubSystemID string `xml:"pci_sub_system_id"`
-			PciGpuLinkInfo struct {
-				Text    string `xml:",chardata"`
-				PcieGen struct {
-					Text                 string `xml:",chardata"`
-					MaxLinkGen           string `xml:"max_link_gen"`
-					CurrentLinkGen       string `xml:"current_link_gen"`
-					DeviceCurrentLinkGen string `xml:"device_current_link_gen"`
-					MaxDeviceLinkGen     string `xml:"max_device_link_gen"`
-					MaxHostLinkGen       string `xml:"max_host_link_gen"`
-				} `xml:"pcie_gen"`
-				LinkWidths struct {
-					Text             string `xml:",chardata"`
-					MaxLinkWidth     string `xml:"max_link_width"`
-					CurrentLinkWidth string `xml:"current_link_width"`
-				} `xml:"link_widths"`
-			} `xml:"pci_gpu_link_info"`
-			PciBridgeChip struct {
-				Text           string `xml:",chardata"`
-				BridgeChipType string `xml:"bridge_chip_type"`
-				BridgeChipFw   string `xml:"bridge_chip_fw"`
-			} `xml:"pci_bridge_chip"`
-			ReplayCounter         string `xml:"replay_counter"`
-			ReplayRolloverCounter string `xml:"replay_rollover_counter"`
-			TxUtil                string `xml:"tx_util"`
-			RxUtil                string `xml:"rx_util"`
-			AtomicCapsInbound     string `xml:"atomic_caps_inbound"`
-			AtomicCapsOutbound    string `xml:"atomic_caps_outbound"`
-		} `xml:"pci"`
-		FanSpeed           string `xml:"fan_speed"`
-		PerformanceState   string `xml:"performance_state"`
-		ClocksEventReasons struct {
-			Text                                       string `xml:",chardata"`
-			ClocksEventReasonGpuIdle                   string `xml:"clocks_event_reason_gpu_idle"`
-			ClocksEventReasonApplicationsClocksSetting string `xml:"clocks_event_reason_applications_clocks_setting"`
-			ClocksEventReasonSwPowerCap                string `xml:"clocks_event_reason_sw_power_cap"`
-			ClocksEventReasonHwSlowdown                string `xml:"clocks_event_reason_hw_slowdown"`
-			ClocksEventReasonHwThermalSlowdown         string `xml:"clocks_event_reason_hw_thermal_slowdown"`
-			ClocksEventReasonHwPowerBrakeSlowdown      string `xml:"clocks_event_reason_hw_power_brake_slowdown"`
-			ClocksEventReasonSyncBoost                 string `xml:"clocks_event_reason_sync_boost"`
-			ClocksEventReasonSwThermalSlowdown         string `xml:"clocks_event_reason_sw_thermal_slowdown"`
-			ClocksEventReasonDisplayClocksSetting      string `xml:"clocks_event_reason_display_clocks_setting"`
-		} `xml:"clocks_event_reasons"`
-		SparseOperationMode string `xml:"sparse_operation_mode"`
-		FbMemoryUsage       struct {
-			Text     string `xml:",chardata"`
-			Total    string `xml:"total"`
-			Reserved string `xml:"reserved"`
-			Used     string `xml:"used"`
-			Free     string `xml:"free"`
-		} `xml:"fb_memory_usage"`
-		Bar1MemoryUsage struct {
-			Text  string `xml:",chardata"`
-			Total string `xml:"total"`
-			Used  string `xml:"used"`
-			Free  string `xml:"free"`
-		} `xml:"bar1_memory_usage"`
-		CcProtectedMemoryUsage struct {
-			Text  string `xml:",chardata"`
-			Total string `xml:"total"`
-			Used  string `xml:"used"`
-			Free  string `xml:"free"`
-		} `xml:"cc_protected_memory_usage"`
-		ComputeMode string `xml:"compute_mode"`
-		Utilization struct {
-			Text        string `xml:",chardata"`
-			GpuUtil     string `xml:"gpu_util"`
-			MemoryUtil  string `xml:"memory_util"`
-			EncoderUtil string `xml:"encoder_util"`
-			DecoderUtil string `xml:"decoder_util"`
-			JpegUtil    string `xml:"jpeg_util"`
-			OfaUtil     string `xml:"ofa_util"`
-		} `xml:"utilization"`
-		EncoderStats struct {
-			Text           string `xml:",chardata"`
-			SessionCount   string `xml:"session_count"`
-			AverageFps     string `xml:"average_fps"`
-			AverageLatency string `xml:"average_latency"`
-		} `xml:"encoder_stats"`
-		FbcStats struct {
-			Text           string `xml:",chardata"`
-			SessionCount   string `xml:"session_count"`
-			AverageFps     string `xml:"average_fps"`
-			AverageLatency string `xml:"average_latency"`
-		} `xml:"fbc_stats"`
-		EccMode struct {
-			Text       string `xml:",chardata"`
-			CurrentEcc string `xml:"current_ecc"`
-			PendingEcc string `xml:"pending_ecc"`
-		} `xml:"ecc_mode"`
-		EccErrors struct {
-			Text     string `xml:",chardata"`
-			Volatile struct {
-				Text                    string `xml:",chardata"`
-				SramCorrectable         string `xml:"sram_correctable"`
-				SramUncorrectableParity string `xml:"sram_uncorrectable_parity"`
-				SramUncorrectableSecded string `xml:"sram_uncorrectable_secded"`
-				DramCorrectable         string `xml:"dram_correctable"`
-				DramUncorrectable       string `xml:"dram_uncorrectable"`
-			} `xml:"volatile"`
-			Aggregate struct {
-				Text                    string `xml:",chardata"`
-				SramCorrectable         string `xml:"sram_correctable"`
-				SramUncorrectableParity string `xml:"sram_uncorrectable_parity"`
-				SramUncorrectableSecded string `xml:"sram_uncorrectable_secded"`
-				DramCorrectable         string `xml:"dram_correctable"`
-				DramUncorrectable       string `xml:"dram_uncorrectable"`
-				SramThresholdExceeded   string `xml:"sram_threshold_exceeded"`
-			} `xml:"aggregate"`
-			AggregateUncorrectableSramSources struct {
-				Text                string `xml:",chardata"`
-				SramL2              string `xml:"sram_l2"`
-				SramSm              string `xml:"sram_sm"`
-				SramMicrocontroller string `xml:"sram_microcontroller"`
-				SramPcie            string `xml:"sram_pcie"`
-				SramOther           string `xml:"sram_other"`
-			} `xml:"aggregate_uncorrectable_sram_sources"`
-		} `xml:"ecc_errors"`
-		RetiredPages struct {
-			Text                        string `xml:",chardata"`
-			MultipleSingleBitRetirement struct {
-				Text            string `xml:",chardata"`
-				RetiredCount    string `xml:"retired_count"`
-				RetiredPagelist string `xml:"retired_pagelist"`
-			} `xml:"multiple_single_bit_retirement"`
-			DoubleBitRetirement struct {
-				Text            string `xml:",chardata"`
-				RetiredCount    string `xml:"retired_count"`
-				RetiredPagelist string `xml:"retired_pagelist"`
-			} `xml:"double_bit_retirement"`
-			PendingBlacklist  string `xml:"pending_blacklist"`
-			PendingRetirement string `xml:"pending_retirement"`
-		} `xml:"retired_pages"`
-		RemappedRows struct {
-			Text                 string `xml:",chardata"`
-			RemappedRowCorr      string `xml:"remapped_row_corr"`
-			RemappedRowUnc       string `xml:"remapped_row_unc"`
-			RemappedRowPending   string `xml:"remapped_row_pending"`
-			RemappedRowFailure   string `xml:"remapped_row_failure"`
-			RowRemapperHistogram struct {
-				Text                        string `xml:",chardata"`
-				RowRemapperHistogramMax     string `xml:"row_remapper_histogram_max"`
-				RowRemapperHistogramHigh    string `xml:"row_remapper_histogram_high"`
-				RowRemapperHistogramPartial string `xml:"row_remapper_histogram_partial"`
-				RowRemapperHistogramLow     string `xml:"row_remapper_histogram_low"`
-				RowRemapperHistogramNone    string `xml:"row_remapper_histogram_none"`
-			} `xml:"row_remapper_histogram"`
-		} `xml:"remapped_rows"`
-		Temperature struct {
-			Text                   string `xml:",chardata"`
-			GpuTemp                string `xml:"gpu_temp"`
-			GpuTempTlimit          string `xml:"gpu_temp_tlimit"`
-			GpuTempMaxThreshold    string `xml:"gpu_temp_max_threshold"`
-			GpuTempSlowThreshold   string `xml:"gpu_temp_slow_threshold"`
-			GpuTempMaxGpuThreshold string `xml:"gpu_temp_max_gpu_threshold"`
-			GpuTargetTemperature   string `xml:"gpu_target_temperature"`
-			MemoryTemp             string `xml:"memory_temp"`
-			GpuTempMaxMemThreshold string `xml:"gpu_temp_max_mem_threshold"`
-		} `xml:"temperature"`
-		SupportedGpuTargetTemp struct {
-			Text             string `xml:",chardata"`
-			GpuTargetTempMin string `xml:"gpu_target_temp_min"`
-			GpuTargetTempMax string `xml:"gpu_target_temp_max"`
-		} `xml:"supported_gpu_target_temp"`
-		GpuPowerReadings struct {
-			Text                string `xml:",chardata"`
-			PowerState          string `xml:"power_state"`
-			PowerDraw           string `xml:"power_draw"`
-			CurrentPowerLimit   string `xml:"current_power_limit"`
-			RequestedPowerLimit string `xml:"requested_power_limit"`
-			DefaultPowerLimit   string `xml:"default_power_limit"`
-			MinPowerLimit       string `xml:"min_power_limit"`
-			MaxPowerLimit       string `xml:"max_power_limit"`
-		} `xml:"gpu_power_readings"`
-		GpuMemoryPowerReadings struct {
-			Text      string `xml:",chardata"`
-			PowerDraw string `xml:"power_draw"`
-		} `xml:"gpu_memory_power_readings"`
-		ModulePowerReadings struct {
-			Text                string `xml:",chardata"`
-			PowerState          string `xml:"power_state"`
-			PowerDraw           string `xml:"power_draw"`
-			CurrentPowerLimit   string `xml:"current_power_limit"`
-			RequestedPowerLimit string `xml:"requested_power_limit"`
-			DefaultPowerLimit   string `xml:"default_power_limit"`
-			MinPowerLimit       string `xml:"min_power_limit"`
-			MaxPowerLimit       string `xml:"max_power_limit"`
-		} `xml:"module_power_readings"`
-		Clocks struct {
-			Text          string `xml:",chardata"`
-			GraphicsClock string `xml:"graphics_clock"`
-			SmClock       string `xml:"sm_clock"`
-			MemClock      string `xml:"mem_clock"`
-			VideoClock    string `xml:"video_clock"`
-		} `xml:"clocks"`
-		ApplicationsClocks struct {
-			Text          string `xml:",chardata"`
-			GraphicsClock string `xml:"graphics_clock"`
-			MemClock      string `xml:"mem_clock"`
-		} `xml:"applications_clocks"`
-		DefaultApplicationsClocks struct {
-			Text          string `xml:",chardata"`
-			GraphicsClock string `xml:"graphics_clock"`
-			MemClock      string `xml:"mem_clock"`
-		} `xml:"default_applications_clocks"`
-		DeferredClocks struct {
-			Text     string `xml:",chardata"`
-			MemClock string `xml:"mem_clock"`
-		} `xml:"deferred_clocks"`
-		MaxClocks struct {
-			Text          string `xml:",chardata"`
-			GraphicsClock string `xml:"graphics_clock"`
-			SmClock       string `xml:"sm_clock"`
-			MemClock      string `xml:"mem_clock"`
-			VideoClock    string `xml:"video_clock"`
-		} `xml:"max_clocks"`
-		MaxCustomerBoostClocks struct {
-			Text          string `xml:",chardata"`
-			GraphicsClock string `xml:"graphics_clock"`
-		} `xml:"max_customer_boost_clocks"`
-		ClockPolicy struct {
-			Text             string `xml:",chardata"`
-			AutoBoost        string `xml:"auto_boost"`
-			AutoBoostDefault string `xml:"auto_boost_default"`
-		} `xml:"clock_policy"`
-		Voltage struct {
-			Text         string `xml:",chardata"`
-			GraphicsVolt string `xml:"graphics_volt"`
-		} `xml:"voltage"`
-		Fabric struct {
-			Text        string `xml:",chardata"`
-			State       string `xml:"state"`
-			Status      string `xml:"status"`
-			CliqueId    string `xml:"cliqueId"`
-			ClusterUuid string `xml:"clusterUuid"`
-			Health      struct {
-				Text      string `xml:",chardata"`
-				Bandwidth string `xml:"bandwidth"`
-			} `xml:"health"`
-		} `xml:"fabric"`
-		SupportedClocks struct {
-			Text              string `xml:",chardata"`
-			SupportedMemClock []struct {
-				Text                   string   `xml:",chardata"`
-				Value                  string   `xml:"value"`
-				SupportedGraphicsClock []string `xml:"supported_graphics_clock"`
-			} `xml:"supported_mem_clock"`
-		} `xml:"supported_clocks"`
-		Processes struct {
-			Text        string `xml:",chardata"`
-			ProcessInfo []struct {
-				Text              string `xml:",chardata"`
-				GpuInstanceID     string `xml:"gpu_instance_id"`
-				ComputeInstanceID string `xml:"compute_instance_id"`
-				Pid               string `xml:"pid"`
-				Type              string `xml:"type"`
-				ProcessName       string `xml:"process_name"`
-				UsedMemory        string `xml:"used_memory"`
-			} `xml:"process_info"`
-		} `xml:"processes"`
-		AccountedProcesses string `xml:"accounted_processes"`
-		Capabilities       struct {
-			Text string `xml:",chardata"`
-			Egm  string `xml:"egm"`
-		} `xml:"capabilities"`
-	} `xml:"gpu"`
-}
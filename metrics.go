@@ -0,0 +1,427 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Unit is the unit a Reading is expressed in.
+type Unit int
+
+const (
+	UnitCount Unit = iota
+	UnitBytes
+	UnitWatts
+	UnitCelsius
+	UnitPercent
+	UnitMHz
+)
+
+// Status tells whether a Reading carries a value.
+type Status int
+
+const (
+	// StatusOK means Value holds the reading.
+	StatusOK Status = iota
+	// StatusMissing means nvidia-smi did not report the field at all.
+	StatusMissing
+	// StatusNA means nvidia-smi reported "N/A".
+	StatusNA
+	// StatusNotSupported means the GPU or driver does not support the field.
+	StatusNotSupported
+	// StatusInvalid means the field was reported but could not be parsed.
+	StatusInvalid
+)
+
+// Reading is a single normalized value. Memory is stored in bytes, power in watts,
+// temperature in degrees Celsius, utilization in percent and clocks in MHz.
+type Reading struct {
+	Value  float64
+	Unit   Unit
+	Status Status
+}
+
+// OK reports whether the reading carries a value.
+func (r Reading) OK() bool {
+	return r.Status == StatusOK
+}
+
+// String formats the reading the same way nvidia-smi does.
+func (r Reading) String() string {
+	switch r.Status {
+	case StatusMissing:
+		return "-"
+	case StatusNA:
+		return "N/A"
+	case StatusNotSupported:
+		return "Not Supported"
+	case StatusInvalid:
+		return "invalid"
+	}
+
+	switch r.Unit {
+	case UnitBytes:
+		return fmt.Sprintf("%.0f MiB", r.Value/mib)
+	case UnitWatts:
+		return fmt.Sprintf("%.2f W", r.Value)
+	case UnitCelsius:
+		return fmt.Sprintf("%.0f C", r.Value)
+	case UnitPercent:
+		return fmt.Sprintf("%.0f %%", r.Value)
+	case UnitMHz:
+		return fmt.Sprintf("%.0f MHz", r.Value)
+	default:
+		return strconv.FormatFloat(r.Value, 'f', -1, 64)
+	}
+}
+
+const (
+	kib = 1 << 10
+	mib = 1 << 20
+	gib = 1 << 30
+)
+
+var unitSuffixes = map[Unit]map[string]float64{
+	UnitBytes:   {"B": 1, "KiB": kib, "MiB": mib, "GiB": gib},
+	UnitWatts:   {"W": 1},
+	UnitCelsius: {"C": 1},
+	UnitPercent: {"%": 1},
+	UnitMHz:     {"MHz": 1},
+}
+
+// parseReading parses a raw nvidia-smi value such as "16376 MiB", "124.19 W" or "N/A".
+func parseReading(raw string, unit Unit) (Reading, error) {
+	r := Reading{Unit: unit}
+
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "":
+		r.Status = StatusMissing
+		return r, nil
+	case raw == "N/A" || raw == "[N/A]":
+		r.Status = StatusNA
+		return r, nil
+	case strings.Contains(raw, "Not Supported"):
+		r.Status = StatusNotSupported
+		return r, nil
+	}
+
+	fields := strings.Fields(raw)
+	if len(fields) > 2 {
+		r.Status = StatusInvalid
+		return r, errors.New("unexpected format")
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		r.Status = StatusInvalid
+		return r, fmt.Errorf("not a number: %w", err)
+	}
+
+	scale := 1.0
+	if suffixes, ok := unitSuffixes[unit]; ok {
+		if len(fields) != 2 {
+			r.Status = StatusInvalid
+			return r, errors.New("missing unit")
+		}
+		scale, ok = suffixes[fields[1]]
+		if !ok {
+			r.Status = StatusInvalid
+			return r, fmt.Errorf("unexpected unit %q", fields[1])
+		}
+	}
+
+	r.Value = value * scale
+	return r, nil
+}
+
+// FieldError describes a field of the nvidia-smi output that could not be parsed.
+type FieldError struct {
+	Field string
+	Raw   string
+	Err   error
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: cannot parse %q: %v", e.Field, e.Raw, e.Err)
+}
+
+// GPU is the normalized view of a single GPU derived from NvidiaSmiGpu.
+type GPU struct {
+	Index            int
+	ID               string
+	UUID             string
+	Name             string
+	Architecture     string
+	PerformanceState string
+
+	// ResetRequired and DrainAndResetRecommended are "Yes" when the GPU must be reset to run jobs again.
+	ResetRequired            string
+	DrainAndResetRecommended string
+	// FabricState, FabricStatus and FabricBandwidth describe the NVLink fabric registration of GPUs
+	// in NVSwitch systems, e.g. "Completed", "Success" and "Full".
+	FabricState     string
+	FabricStatus    string
+	FabricBandwidth string
+
+	FanSpeed Reading
+
+	MemoryTotal    Reading
+	MemoryReserved Reading
+	MemoryUsed     Reading
+	MemoryFree     Reading
+
+	GPUUtil    Reading
+	MemoryUtil Reading
+
+	Temperature  Reading
+	TempSlowdown Reading
+	TempShutdown Reading
+
+	PowerDraw         Reading
+	PowerLimit        Reading
+	PowerDefaultLimit Reading
+	PowerMinLimit     Reading
+	PowerMaxLimit     Reading
+
+	GraphicsClock    Reading
+	SMClock          Reading
+	MemClock         Reading
+	MaxGraphicsClock Reading
+	MaxSMClock       Reading
+	MaxMemClock      Reading
+
+	// ClockEventReasons lists the active clock event (throttle) reasons,
+	// named after the nvidia-smi fields without the prefix, e.g. "sw_power_cap".
+	ClockEventReasons []string
+
+	PCIeGen      Reading
+	PCIeMaxGen   Reading
+	PCIeWidth    Reading
+	PCIeMaxWidth Reading
+	// PCIeReplays counts the link-level retransmissions, which grow on a bad link.
+	PCIeReplays         Reading
+	PCIeReplayRollovers Reading
+
+	ECCMode      string
+	ECCVolatile  ECCErrors
+	ECCAggregate ECCErrors
+	// ECCSRAMThresholdExceeded tells whether the SRAM errors passed the limit after which the GPU should be replaced.
+	ECCSRAMThresholdExceeded string
+
+	// Page retirement is reported by GPUs before Ampere, row remapping by Ampere and later.
+	RetiredPagesSingleBit     Reading
+	RetiredPagesDoubleBit     Reading
+	RetiredPagesPending       string
+	RemappedRowsCorrectable   Reading
+	RemappedRowsUncorrectable Reading
+	RemappedRowsPending       string
+	RemappedRowsFailure       string
+	RowRemapHistogram         RowRemapHistogram
+
+	Processes []Process
+
+	// Errors lists the fields that were reported but could not be parsed.
+	Errors []FieldError
+}
+
+// ECCErrors holds the ECC error counters of one kind, volatile or aggregate.
+type ECCErrors struct {
+	SRAMCorrectable   Reading
+	SRAMUncorrectable Reading
+	DRAMCorrectable   Reading
+	DRAMUncorrectable Reading
+}
+
+// RowRemapHistogram counts the memory banks by the spare rows they have left for remapping.
+type RowRemapHistogram struct {
+	Max     Reading
+	High    Reading
+	Partial Reading
+	Low     Reading
+	None    Reading
+}
+
+// Process is a process running on a GPU.
+type Process struct {
+	PID        int
+	Type       string
+	Name       string
+	UsedMemory Reading
+}
+
+// gpuParser collects field errors while converting a single GPU.
+type gpuParser struct {
+	errors []FieldError
+}
+
+func (p *gpuParser) reading(field, raw string, unit Unit) Reading {
+	r, err := parseReading(raw, unit)
+	if err != nil {
+		p.errors = append(p.errors, FieldError{Field: field, Raw: raw, Err: err})
+	}
+	return r
+}
+
+// sramUncorrectable sums the parity and SEC-DED counters, falling back to the
+// single counter reported by older drivers.
+func (p *gpuParser) sramUncorrectable(prefix, total, parity, secded string) Reading {
+	if parity == "" && secded == "" {
+		return p.reading(prefix+".sram_uncorrectable", total, UnitCount)
+	}
+
+	r := p.reading(prefix+".sram_uncorrectable_parity", parity, UnitCount)
+	s := p.reading(prefix+".sram_uncorrectable_secded", secded, UnitCount)
+	if r.OK() && s.OK() {
+		r.Value += s.Value
+	}
+
+	return r
+}
+
+func activeClockEventReasons(g *NvidiaSmiGpu) []string {
+	reasons := g.ClocksEventReasons
+	flags := []struct {
+		name  string
+		value string
+	}{
+		{"gpu_idle", reasons.ClocksEventReasonGpuIdle},
+		{"applications_clocks_setting", reasons.ClocksEventReasonApplicationsClocksSetting},
+		{"sw_power_cap", reasons.ClocksEventReasonSwPowerCap},
+		{"hw_slowdown", reasons.ClocksEventReasonHwSlowdown},
+		{"hw_thermal_slowdown", reasons.ClocksEventReasonHwThermalSlowdown},
+		{"hw_power_brake_slowdown", reasons.ClocksEventReasonHwPowerBrakeSlowdown},
+		{"sync_boost", reasons.ClocksEventReasonSyncBoost},
+		{"sw_thermal_slowdown", reasons.ClocksEventReasonSwThermalSlowdown},
+		{"display_clocks_setting", reasons.ClocksEventReasonDisplayClocksSetting},
+	}
+
+	var active []string
+	for _, flag := range flags {
+		if strings.TrimSpace(flag.value) == "Active" {
+			active = append(active, flag.name)
+		}
+	}
+
+	return active
+}
+
+// pendingRetirement returns whether pages are waiting to be retired on the next reboot.
+// Drivers before 450 call it pending_blacklist.
+func pendingRetirement(g *NvidiaSmiGpu) string {
+	if pending := strings.TrimSpace(g.RetiredPages.PendingRetirement); pending != "" {
+		return pending
+	}
+
+	return strings.TrimSpace(g.RetiredPages.PendingBlacklist)
+}
+
+func newGPU(index int, g *NvidiaSmiGpu) GPU {
+	var p gpuParser
+
+	gpu := GPU{
+		Index:        index,
+		ID:           g.ID,
+		UUID:         g.Uuid,
+		Name:         g.ProductName,
+		Architecture: g.ProductArchitecture,
+
+		PerformanceState: g.PerformanceState,
+
+		ResetRequired:            strings.TrimSpace(g.GpuResetStatus.ResetRequired),
+		DrainAndResetRecommended: strings.TrimSpace(g.GpuResetStatus.DrainAndResetRecommended),
+		FabricState:              strings.TrimSpace(g.Fabric.State),
+		FabricStatus:             strings.TrimSpace(g.Fabric.Status),
+		FabricBandwidth:          strings.TrimSpace(g.Fabric.Health.Bandwidth),
+
+		FanSpeed: p.reading("fan_speed", g.FanSpeed, UnitPercent),
+
+		MemoryTotal:    p.reading("fb_memory_usage.total", g.FbMemoryUsage.Total, UnitBytes),
+		MemoryReserved: p.reading("fb_memory_usage.reserved", g.FbMemoryUsage.Reserved, UnitBytes),
+		MemoryUsed:     p.reading("fb_memory_usage.used", g.FbMemoryUsage.Used, UnitBytes),
+		MemoryFree:     p.reading("fb_memory_usage.free", g.FbMemoryUsage.Free, UnitBytes),
+
+		GPUUtil:    p.reading("utilization.gpu_util", g.Utilization.GpuUtil, UnitPercent),
+		MemoryUtil: p.reading("utilization.memory_util", g.Utilization.MemoryUtil, UnitPercent),
+
+		Temperature:  p.reading("temperature.gpu_temp", g.Temperature.GpuTemp, UnitCelsius),
+		TempSlowdown: p.reading("temperature.gpu_temp_slow_threshold", g.Temperature.GpuTempSlowThreshold, UnitCelsius),
+		TempShutdown: p.reading("temperature.gpu_temp_max_threshold", g.Temperature.GpuTempMaxThreshold, UnitCelsius),
+
+		PowerDraw:  p.reading("gpu_power_readings.power_draw", g.GpuPowerReadings.PowerDraw, UnitWatts),
+		PowerLimit: p.reading("gpu_power_readings.current_power_limit", g.GpuPowerReadings.CurrentPowerLimit, UnitWatts),
+
+		PowerDefaultLimit: p.reading("gpu_power_readings.default_power_limit", g.GpuPowerReadings.DefaultPowerLimit, UnitWatts),
+		PowerMinLimit:     p.reading("gpu_power_readings.min_power_limit", g.GpuPowerReadings.MinPowerLimit, UnitWatts),
+		PowerMaxLimit:     p.reading("gpu_power_readings.max_power_limit", g.GpuPowerReadings.MaxPowerLimit, UnitWatts),
+
+		GraphicsClock:    p.reading("clocks.graphics_clock", g.Clocks.GraphicsClock, UnitMHz),
+		SMClock:          p.reading("clocks.sm_clock", g.Clocks.SmClock, UnitMHz),
+		MemClock:         p.reading("clocks.mem_clock", g.Clocks.MemClock, UnitMHz),
+		MaxGraphicsClock: p.reading("max_clocks.graphics_clock", g.MaxClocks.GraphicsClock, UnitMHz),
+		MaxSMClock:       p.reading("max_clocks.sm_clock", g.MaxClocks.SmClock, UnitMHz),
+		MaxMemClock:      p.reading("max_clocks.mem_clock", g.MaxClocks.MemClock, UnitMHz),
+
+		PCIeGen:      p.reading("pci.pci_gpu_link_info.pcie_gen.current_link_gen", g.Pci.PciGpuLinkInfo.PcieGen.CurrentLinkGen, UnitCount),
+		PCIeMaxGen:   p.reading("pci.pci_gpu_link_info.pcie_gen.max_link_gen", g.Pci.PciGpuLinkInfo.PcieGen.MaxLinkGen, UnitCount),
+		PCIeWidth:    p.reading("pci.pci_gpu_link_info.link_widths.current_link_width", strings.TrimSuffix(g.Pci.PciGpuLinkInfo.LinkWidths.CurrentLinkWidth, "x"), UnitCount),
+		PCIeMaxWidth: p.reading("pci.pci_gpu_link_info.link_widths.max_link_width", strings.TrimSuffix(g.Pci.PciGpuLinkInfo.LinkWidths.MaxLinkWidth, "x"), UnitCount),
+
+		PCIeReplays:         p.reading("pci.replay_counter", g.Pci.ReplayCounter, UnitCount),
+		PCIeReplayRollovers: p.reading("pci.replay_rollover_counter", g.Pci.ReplayRolloverCounter, UnitCount),
+
+		ECCMode: g.EccMode.CurrentEcc,
+		ECCVolatile: ECCErrors{
+			SRAMCorrectable:   p.reading("ecc_errors.volatile.sram_correctable", g.EccErrors.Volatile.SramCorrectable, UnitCount),
+			SRAMUncorrectable: p.sramUncorrectable("ecc_errors.volatile", g.EccErrors.Volatile.SramUncorrectable, g.EccErrors.Volatile.SramUncorrectableParity, g.EccErrors.Volatile.SramUncorrectableSecded),
+			DRAMCorrectable:   p.reading("ecc_errors.volatile.dram_correctable", g.EccErrors.Volatile.DramCorrectable, UnitCount),
+			DRAMUncorrectable: p.reading("ecc_errors.volatile.dram_uncorrectable", g.EccErrors.Volatile.DramUncorrectable, UnitCount),
+		},
+		ECCAggregate: ECCErrors{
+			SRAMCorrectable:   p.reading("ecc_errors.aggregate.sram_correctable", g.EccErrors.Aggregate.SramCorrectable, UnitCount),
+			SRAMUncorrectable: p.sramUncorrectable("ecc_errors.aggregate", g.EccErrors.Aggregate.SramUncorrectable, g.EccErrors.Aggregate.SramUncorrectableParity, g.EccErrors.Aggregate.SramUncorrectableSecded),
+			DRAMCorrectable:   p.reading("ecc_errors.aggregate.dram_correctable", g.EccErrors.Aggregate.DramCorrectable, UnitCount),
+			DRAMUncorrectable: p.reading("ecc_errors.aggregate.dram_uncorrectable", g.EccErrors.Aggregate.DramUncorrectable, UnitCount),
+		},
+		ECCSRAMThresholdExceeded: strings.TrimSpace(g.EccErrors.Aggregate.SramThresholdExceeded),
+
+		RetiredPagesSingleBit:     p.reading("retired_pages.multiple_single_bit_retirement.retired_count", g.RetiredPages.MultipleSingleBitRetirement.RetiredCount, UnitCount),
+		RetiredPagesDoubleBit:     p.reading("retired_pages.double_bit_retirement.retired_count", g.RetiredPages.DoubleBitRetirement.RetiredCount, UnitCount),
+		RetiredPagesPending:       pendingRetirement(g),
+		RemappedRowsCorrectable:   p.reading("remapped_rows.remapped_row_corr", g.RemappedRows.RemappedRowCorr, UnitCount),
+		RemappedRowsUncorrectable: p.reading("remapped_rows.remapped_row_unc", g.RemappedRows.RemappedRowUnc, UnitCount),
+		RemappedRowsPending:       strings.TrimSpace(g.RemappedRows.RemappedRowPending),
+		RemappedRowsFailure:       strings.TrimSpace(g.RemappedRows.RemappedRowFailure),
+		RowRemapHistogram: RowRemapHistogram{
+			Max:     p.reading("remapped_rows.row_remapper_histogram.max", strings.TrimSuffix(g.RemappedRows.RowRemapperHistogram.RowRemapperHistogramMax, " bank(s)"), UnitCount),
+			High:    p.reading("remapped_rows.row_remapper_histogram.high", strings.TrimSuffix(g.RemappedRows.RowRemapperHistogram.RowRemapperHistogramHigh, " bank(s)"), UnitCount),
+			Partial: p.reading("remapped_rows.row_remapper_histogram.partial", strings.TrimSuffix(g.RemappedRows.RowRemapperHistogram.RowRemapperHistogramPartial, " bank(s)"), UnitCount),
+			Low:     p.reading("remapped_rows.row_remapper_histogram.low", strings.TrimSuffix(g.RemappedRows.RowRemapperHistogram.RowRemapperHistogramLow, " bank(s)"), UnitCount),
+			None:    p.reading("remapped_rows.row_remapper_histogram.none", strings.TrimSuffix(g.RemappedRows.RowRemapperHistogram.RowRemapperHistogramNone, " bank(s)"), UnitCount),
+		},
+
+		ClockEventReasons: activeClockEventReasons(g),
+	}
+
+	for i, info := range g.Processes.ProcessInfo {
+		field := fmt.Sprintf("processes.process_info[%d]", i)
+
+		pid, err := strconv.Atoi(strings.TrimSpace(info.Pid))
+		if err != nil {
+			p.errors = append(p.errors, FieldError{Field: field + ".pid", Raw: info.Pid, Err: err})
+			continue
+		}
+
+		gpu.Processes = append(gpu.Processes, Process{
+			PID:        pid,
+			Type:       info.Type,
+			Name:       info.ProcessName,
+			UsedMemory: p.reading(field+".used_memory", info.UsedMemory, UnitBytes),
+		})
+	}
+
+	gpu.Errors = p.errors
+	return gpu
+}
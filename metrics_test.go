@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseReading(t *testing.T) {
+	tests := []struct {
+		raw     string
+		unit    Unit
+		want    Reading
+		wantErr bool
+	}{
+		{"16376 MiB", UnitBytes, Reading{Value: 16376 * mib, Unit: UnitBytes}, false},
+		{"2 GiB", UnitBytes, Reading{Value: 2 * gib, Unit: UnitBytes}, false},
+		{"124.19 W", UnitWatts, Reading{Value: 124.19, Unit: UnitWatts}, false},
+		{"93 C", UnitCelsius, Reading{Value: 93, Unit: UnitCelsius}, false},
+		{"39 %", UnitPercent, Reading{Value: 39, Unit: UnitPercent}, false},
+		{"1560 MHz", UnitMHz, Reading{Value: 1560, Unit: UnitMHz}, false},
+		{"12", UnitCount, Reading{Value: 12, Unit: UnitCount}, false},
+		{"", UnitWatts, Reading{Unit: UnitWatts, Status: StatusMissing}, false},
+		{"N/A", UnitPercent, Reading{Unit: UnitPercent, Status: StatusNA}, false},
+		{"[N/A]", UnitPercent, Reading{Unit: UnitPercent, Status: StatusNA}, false},
+		{"[Not Supported]", UnitMHz, Reading{Unit: UnitMHz, Status: StatusNotSupported}, false},
+		{"93 F", UnitCelsius, Reading{Unit: UnitCelsius, Status: StatusInvalid}, true},
+		{"93", UnitCelsius, Reading{Unit: UnitCelsius, Status: StatusInvalid}, true},
+		{"hot C", UnitCelsius, Reading{Unit: UnitCelsius, Status: StatusInvalid}, true},
+		{"[Unknown Error]", UnitWatts, Reading{Unit: UnitWatts, Status: StatusInvalid}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseReading(tt.raw, tt.unit)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseReading(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("parseReading(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestReadingString(t *testing.T) {
+	tests := []struct {
+		reading Reading
+		want    string
+	}{
+		{Reading{Value: 16376 * mib, Unit: UnitBytes}, "16376 MiB"},
+		{Reading{Value: 140, Unit: UnitWatts}, "140.00 W"},
+		{Reading{Value: 93, Unit: UnitCelsius}, "93 C"},
+		{Reading{Value: 39, Unit: UnitPercent}, "39 %"},
+		{Reading{Unit: UnitPercent, Status: StatusNA}, "N/A"},
+		{Reading{Unit: UnitBytes, Status: StatusMissing}, "-"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.reading.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.reading, got, tt.want)
+		}
+	}
+}
+
+func TestNewGPUReportsFieldErrors(t *testing.T) {
+	s := loadFixture(t, "555")
+	raw := s.Log.Gpu[0]
+	raw.FanSpeed = "[Unknown Error]"
+	raw.Temperature.GpuTemp = "93"
+
+	gpu := newGPU(0, &raw)
+
+	if gpu.FanSpeed.Status != StatusInvalid || gpu.Temperature.Status != StatusInvalid {
+		t.Errorf("invalid fields were not marked: fan %+v, temperature %+v", gpu.FanSpeed, gpu.Temperature)
+	}
+	if len(gpu.Errors) != 2 {
+		t.Fatalf("len(Errors) = %d, want 2: %v", len(gpu.Errors), gpu.Errors)
+	}
+	if gpu.Errors[0].Field != "fan_speed" || gpu.Errors[1].Field != "temperature.gpu_temp" {
+		t.Errorf("unexpected fields in errors: %v", gpu.Errors)
+	}
+	if !gpu.MemoryUsed.OK() || gpu.MemoryUsed.Value != 14551*mib {
+		t.Errorf("MemoryUsed = %+v, want 14551 MiB", gpu.MemoryUsed)
+	}
+}
+
+func TestNewSnapshotFixtures(t *testing.T) {
+	for _, driver := range fixtures {
+		t.Run(driver, func(t *testing.T) {
+			s := loadFixture(t, driver)
+			if len(s.GPUs) != len(s.Log.Gpu) {
+				t.Fatalf("len(GPUs) = %d, want %d", len(s.GPUs), len(s.Log.Gpu))
+			}
+			for _, gpu := range s.GPUs {
+				if len(gpu.Errors) > 0 {
+					t.Errorf("GPU %d: unexpected parse errors: %v", gpu.Index, gpu.Errors)
+				}
+				if !gpu.PowerDraw.OK() || !gpu.PowerLimit.OK() {
+					t.Errorf("GPU %d: power readings missing: %+v / %+v", gpu.Index, gpu.PowerDraw, gpu.PowerLimit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// defaultFreeWatchExpiry is how long a /notify_free request waits for a free GPU.
+	defaultFreeWatchExpiry = 24 * time.Hour
+	// freeWatchesKey is where the store keeps the /notify_free requests.
+	freeWatchesKey = "free_watches"
+)
+
+// freeWatch is a /notify_free request.
+type freeWatch struct {
+	ID      int       `json:"id"`
+	ChatID  int64     `json:"chat_id"`
+	UserID  int64     `json:"user_id"`
+	User    string    `json:"user"`
+	ReplyTo int64     `json:"reply_to"`
+	Expires time.Time `json:"expires"`
+	// GPU is the UUID of the awaited GPU; any GPU will do when it is empty.
+	GPU string `json:"gpu,omitempty"`
+	// MinFree is the free memory in bytes the GPU must have; without it the GPU must have no compute processes.
+	MinFree float64 `json:"min_free,omitempty"`
+}
+
+// matches reports whether the GPU is free for the request.
+func (w *freeWatch) matches(gpu GPU) bool {
+	if w.GPU != "" && w.GPU != gpu.UUID {
+		return false
+	}
+	if w.MinFree > 0 {
+		return gpu.MemoryFree.OK() && gpu.MemoryFree.Value >= w.MinFree
+	}
+	return !slices.ContainsFunc(gpu.Processes, func(p Process) bool { return strings.Contains(p.Type, "C") })
+}
+
+func (w *freeWatch) describe() string {
+	what := "any GPU"
+	if w.GPU != "" {
+		what = "<code>" + html.EscapeString(w.GPU) + "</code>"
+	}
+	if w.MinFree > 0 {
+		return fmt.Sprintf("%s with %.1f GiB free", what, w.MinFree/gib)
+	}
+	return what + " without compute processes"
+}
+
+// mention links the user who made the request, so that group chats notify them.
+func (w *freeWatch) mention() string {
+	return fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, w.UserID, html.EscapeString(w.User))
+}
+
+// freeWatches is how the store keeps the requests; NextID keeps IDs unique across restarts.
+type freeWatches struct {
+	NextID  int          `json:"next_id"`
+	Watches []*freeWatch `json:"watches"`
+}
+
+// FreeWatcher keeps the /notify_free requests and answers them when a GPU becomes free. It is an
+// Observer fed by the poller.
+type FreeWatcher struct {
+	store *Store
+
+	mu      sync.Mutex
+	watches []*freeWatch
+	nextID  int
+}
+
+// NewFreeWatcher creates a FreeWatcher with the requests saved in the store.
+func NewFreeWatcher(store *Store) *FreeWatcher {
+	saved := freeWatches{NextID: 1}
+	if _, err := store.Load(freeWatchesKey, &saved); err != nil {
+		log.Println("failed to load /notify_free requests:", err.Error())
+	}
+
+	return &FreeWatcher{store: store, watches: saved.Watches, nextID: max(saved.NextID, 1)}
+}
+
+// Add registers a request and assigns its ID.
+func (w *FreeWatcher) Add(watch *freeWatch) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	watch.ID = w.nextID
+	w.nextID++
+	w.watches = append(w.watches, watch)
+	w.saveLocked()
+}
+
+// List returns the requests of a chat.
+func (w *FreeWatcher) List(chatID int64) []freeWatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var watches []freeWatch
+	for _, watch := range w.watches {
+		if watch.ChatID == chatID {
+			watches = append(watches, *watch)
+		}
+	}
+	return watches
+}
+
+// Cancel removes the requests of a chat that cancel selects and returns how many it removed.
+func (w *FreeWatcher) Cancel(chatID int64, cancel func(freeWatch) bool) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	before := len(w.watches)
+	w.watches = slices.DeleteFunc(w.watches, func(watch *freeWatch) bool {
+		return watch.ChatID == chatID && cancel(*watch)
+	})
+	if removed := before - len(w.watches); removed > 0 {
+		w.saveLocked()
+		return removed
+	}
+	return 0
+}
+
+func (w *FreeWatcher) Observe(s *Snapshot) []Alert {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var alerts []Alert
+	w.watches = slices.DeleteFunc(w.watches, func(watch *freeWatch) bool {
+		for _, gpu := range s.GPUs {
+			if watch.matches(gpu) {
+				alerts = append(alerts, Alert{
+					ChatID:  watch.ChatID,
+					ReplyTo: watch.ReplyTo,
+					Text:    fmt.Sprintf("%s: %s is free now.\n\n%s", watch.mention(), gpuLabel(gpu), renderFreeGPU(gpu)),
+				})
+				return true
+			}
+		}
+
+		if !s.CollectedAt.Before(watch.Expires) {
+			alerts = append(alerts, Alert{
+				ChatID:  watch.ChatID,
+				ReplyTo: watch.ReplyTo,
+				Text:    fmt.Sprintf("%s: request #%d for %s expired.", watch.mention(), watch.ID, watch.describe()),
+			})
+			return true
+		}
+		return false
+	})
+	if len(alerts) > 0 {
+		w.saveLocked()
+	}
+
+	return alerts
+}
+
+func (w *FreeWatcher) saveLocked() {
+	if err := w.store.Save(freeWatchesKey, freeWatches{NextID: w.nextID, Watches: w.watches}); err != nil {
+		log.Println("failed to save /notify_free requests:", err.Error())
+	}
+}
+
+func renderFreeGPU(gpu GPU) string {
+	return fmt.Sprintf("Memory: %s free of %s, utilization %s, %d processes",
+		formatGiB(gpu.MemoryFree), formatGiB(gpu.MemoryTotal), gpu.GPUUtil, len(gpu.Processes))
+}
+
+// freeWatcher is created in main once the store is open.
+var freeWatcher *FreeWatcher
+
+// parseMemorySize parses sizes such as "20G", "20GiB", "512M" or "20", which is in GiB.
+func parseMemorySize(s string) (float64, error) {
+	upper := strings.ToUpper(s)
+	number, scale := upper, float64(gib)
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"GIB", gib}, {"GB", gib}, {"G", gib}, {"MIB", mib}, {"MB", mib}, {"M", mib}} {
+		if n, ok := strings.CutSuffix(upper, unit.suffix); ok {
+			number, scale = n, unit.scale
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid memory size %q", s)
+	}
+	return value * scale, nil
+}
+
+// looksLikeMemorySize tells a size such as "20G" from a GPU selector such as "1" or a UUID.
+func looksLikeMemorySize(s string) bool {
+	upper := strings.ToUpper(s)
+	return len(s) > 1 && !strings.HasPrefix(upper, "GPU-") && strings.ContainsAny(upper[len(upper)-1:], "GMB") &&
+		strings.ContainsAny(upper[:1], "0123456789.")
+}
+
+const notifyFreeUsage = "Usage: /notify_free [gpu|any] [min_free_mem], e.g. /notify_free, /notify_free 1 or /notify_free any 20G"
+
+// notifyFree handles /notify_free [gpu] [min_free_mem].
+func notifyFree(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+	if len(args) > 2 {
+		return replyHTML(b, ctx, notifyFreeUsage)
+	}
+
+	selector, size := "", ""
+	switch {
+	case len(args) == 2:
+		selector, size = args[0], args[1]
+	case len(args) == 1 && looksLikeMemorySize(args[0]):
+		size = args[0]
+	case len(args) == 1:
+		selector = args[0]
+	}
+
+	watch := &freeWatch{
+		ChatID:  ctx.EffectiveChat.Id,
+		UserID:  ctx.EffectiveSender.Id(),
+		User:    ctx.EffectiveSender.Name(),
+		ReplyTo: ctx.EffectiveMessage.MessageId,
+		Expires: time.Now().Add(settings.Load().FreeWatchExpiry),
+	}
+	if size != "" {
+		var err error
+		if watch.MinFree, err = parseMemorySize(size); err != nil {
+			return replyHTML(b, ctx, html.EscapeString(err.Error())+".\n"+notifyFreeUsage)
+		}
+	}
+
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+	if selector != "" && selector != "any" {
+		gpu, ok := findGPU(snapshot, selector)
+		if !ok {
+			return replyHTML(b, ctx, fmt.Sprintf("Unknown GPU <code>%s</code>.\n\n%s", html.EscapeString(selector), renderGPUSelectors(snapshot)))
+		}
+		watch.GPU = gpu.UUID
+	}
+
+	for _, gpu := range snapshot.GPUs {
+		if watch.matches(gpu) {
+			return replyHTML(b, ctx, fmt.Sprintf("%s is free already.\n\n%s", gpuLabel(gpu), renderFreeGPU(gpu)))
+		}
+	}
+
+	freeWatcher.Add(watch)
+	return replyHTML(b, ctx, fmt.Sprintf("Request #%d: I will tell you when %s is free, until %s. /notify_cancel %d cancels it.",
+		watch.ID, watch.describe(), watch.Expires.Format("Jan 2 15:04"), watch.ID))
+}
+
+// notifyList handles /notify_list and lists the /notify_free requests of the chat.
+func notifyList(b *gotgbot.Bot, ctx *ext.Context) error {
+	watches := freeWatcher.List(ctx.EffectiveChat.Id)
+	if len(watches) == 0 {
+		return replyHTML(b, ctx, "There are no /notify_free requests in this chat.")
+	}
+
+	lines := []string{"<b>/notify_free requests</b>"}
+	for _, watch := range watches {
+		lines = append(lines, fmt.Sprintf("#%d %s for %s, until %s",
+			watch.ID, html.EscapeString(watch.User), watch.describe(), watch.Expires.Format("Jan 2 15:04")))
+	}
+	return replyHTML(b, ctx, strings.Join(lines, "\n"))
+}
+
+// notifyCancel handles /notify_cancel [id]. Without an id it cancels every request of the sender in the chat;
+// admins may cancel the requests of others.
+func notifyCancel(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+	sender := ctx.EffectiveSender.Id()
+	admin := senderRole(ctx) >= RoleAdmin
+
+	var cancel func(freeWatch) bool
+	switch len(args) {
+	case 0:
+		cancel = func(w freeWatch) bool { return w.UserID == sender }
+	case 1:
+		id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+		if err != nil {
+			return replyHTML(b, ctx, "Usage: /notify_cancel [id]")
+		}
+		cancel = func(w freeWatch) bool { return w.ID == id && (w.UserID == sender || admin) }
+	default:
+		return replyHTML(b, ctx, "Usage: /notify_cancel [id]")
+	}
+
+	removed := freeWatcher.Cancel(ctx.EffectiveChat.Id, cancel)
+	if removed == 0 {
+		return replyHTML(b, ctx, "No matching request of yours in this chat, see /notify_list.")
+	}
+	return replyHTML(b, ctx, fmt.Sprintf("Cancelled %d request(s).", removed))
+}
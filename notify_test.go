@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFreeWatcher(t *testing.T) {
+	store := testStore(t)
+	s := loadFixture(t, "555")
+	start := s.CollectedAt
+
+	w := NewFreeWatcher(store)
+	w.Add(&freeWatch{ChatID: 1, UserID: 11, User: "Alice", ReplyTo: 5, Expires: start.Add(time.Hour), GPU: s.GPUs[1].UUID})
+	w.Add(&freeWatch{ChatID: 1, UserID: 12, User: "Bob", Expires: start.Add(time.Hour), MinFree: 8 * gib})
+	w.Add(&freeWatch{ChatID: 2, UserID: 13, User: "Carol", Expires: start.Add(time.Hour), MinFree: 1.4 * gib})
+
+	// The third request is met at once: both GPUs have more than 1.4 GiB free.
+	alerts := w.Observe(s)
+	if len(alerts) != 1 || alerts[0].ChatID != 2 || !strings.Contains(alerts[0].Text, "is free now") {
+		t.Fatalf("expected the 1.4 GiB request to be answered, got %v", alerts)
+	}
+
+	// The requests survive a restart.
+	w = NewFreeWatcher(store)
+	if watches := w.List(1); len(watches) != 2 || watches[0].ID != 1 || watches[1].ID != 2 {
+		t.Fatalf("unexpected requests after restart: %v", watches)
+	}
+
+	s.GPUs[1].Processes = nil
+	s.CollectedAt = start.Add(time.Minute)
+	alerts = w.Observe(s)
+	if len(alerts) != 1 || alerts[0].ReplyTo != 5 {
+		t.Fatalf("expected the GPU 1 request to be answered, got %v", alerts)
+	}
+	for _, want := range []string{"tg://user?id=11", "GPU 1", "0 processes"} {
+		if !strings.Contains(alerts[0].Text, want) {
+			t.Errorf("notice does not contain %q:\n%s", want, alerts[0].Text)
+		}
+	}
+
+	s.CollectedAt = start.Add(time.Hour)
+	alerts = w.Observe(s)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "request #2 for any GPU with 8.0 GiB free expired") {
+		t.Fatalf("expected the 8 GiB request to expire, got %v", alerts)
+	}
+	if watches := w.List(1); len(watches) != 0 {
+		t.Fatalf("requests left: %v", watches)
+	}
+
+	// IDs are not reused after a restart.
+	w = NewFreeWatcher(store)
+	watch := &freeWatch{ChatID: 1, UserID: 11, Expires: start.Add(2 * time.Hour)}
+	w.Add(watch)
+	if watch.ID != 4 {
+		t.Errorf("expected ID 4, got %d", watch.ID)
+	}
+	if n := w.Cancel(1, func(w freeWatch) bool { return w.UserID == 12 }); n != 0 {
+		t.Errorf("cancelled %d requests of another user", n)
+	}
+	if n := w.Cancel(1, func(w freeWatch) bool { return w.UserID == 11 }); n != 1 {
+		t.Errorf("expected to cancel 1 request, cancelled %d", n)
+	}
+}
+
+func TestParseMemorySize(t *testing.T) {
+	for input, want := range map[string]float64{
+		"20":     20 * gib,
+		"20G":    20 * gib,
+		"20gib":  20 * gib,
+		"1.5GB":  1.5 * gib,
+		"512M":   512 * mib,
+		"512MiB": 512 * mib,
+	} {
+		got, err := parseMemorySize(input)
+		if err != nil || got != want {
+			t.Errorf("parseMemorySize(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "G", "-1G", "0", "lots"} {
+		if _, err := parseMemorySize(input); err == nil {
+			t.Errorf("parseMemorySize(%q) did not fail", input)
+		}
+	}
+
+	for input, want := range map[string]bool{"20G": true, "512m": true, "1": false, "any": false, "GPU-4b8e": false, "00000000:02:00.0": false} {
+		if got := looksLikeMemorySize(input); got != want {
+			t.Errorf("looksLikeMemorySize(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
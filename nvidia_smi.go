@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrNoNvidiaSmi is returned by NvidiaSmiCollector when the binary is not in PATH.
+	ErrNoNvidiaSmi = errors.New("no nvidia-smi binary")
+	// ErrDriverNotLoaded is returned when nvidia-smi cannot talk to the NVIDIA driver.
+	ErrDriverNotLoaded = errors.New("nvidia driver is not loaded")
+	// ErrNvidiaSmiTimeout is returned when nvidia-smi does not finish in time, which usually means a hung driver.
+	ErrNvidiaSmiTimeout = errors.New("nvidia-smi timed out")
+	// ErrMalformedXML is returned when the output of nvidia-smi cannot be parsed.
+	ErrMalformedXML = errors.New("malformed nvidia-smi xml")
+)
+
+// exitDriverNotLoaded is the exit code of nvidia-smi when the driver is not loaded.
+const exitDriverNotLoaded = 9
+
+// NvidiaSmiExitError is returned when nvidia-smi exits with a non-zero code.
+type NvidiaSmiExitError struct {
+	Code int
+	// Output is what nvidia-smi printed on stderr, or on stdout if stderr is empty.
+	Output string
+}
+
+func (e *NvidiaSmiExitError) Error() string {
+	return fmt.Sprintf("nvidia-smi exited with code %d: %s", e.Code, e.Output)
+}
+
+// defaultNvidiaSmiTimeout is how long nvidia-smi may run before it is killed.
+const defaultNvidiaSmiTimeout = 10 * time.Second
+
+// NvidiaSmiCollector collects snapshots by running `nvidia-smi -q -x`.
+type NvidiaSmiCollector struct {
+	// Binary is the name or path of the nvidia-smi executable.
+	Binary string
+	// Timeout limits a single run of nvidia-smi; zero means no limit.
+	Timeout time.Duration
+}
+
+func NewNvidiaSmiCollector() *NvidiaSmiCollector {
+	return &NvidiaSmiCollector{Binary: "nvidia-smi", Timeout: defaultNvidiaSmiTimeout}
+}
+
+func (c *NvidiaSmiCollector) Collect(ctx context.Context) (*Snapshot, error) {
+	if _, err := exec.LookPath(c.Binary); err != nil {
+		return nil, ErrNoNvidiaSmi
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, c.Binary, "-q", "-x")
+	// nvidia-smi runs in its own process group, so that a timeout kills everything it started.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// A process stuck in the driver may not die right away; stop waiting for its output after a while.
+	cmd.WaitDelay = time.Second
+
+	var outb, errb bytes.Buffer
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+	err := cmd.Run()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s", ErrNvidiaSmiTimeout, c.Timeout)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// nvidia-smi reports most failures on stdout.
+		output := strings.TrimSpace(errb.String())
+		if output == "" {
+			output = strings.TrimSpace(outb.String())
+		}
+
+		if exitErr.ExitCode() == exitDriverNotLoaded || strings.Contains(output, "couldn't communicate with the NVIDIA driver") {
+			return nil, fmt.Errorf("%w: %s", ErrDriverNotLoaded, output)
+		}
+		return nil, &NvidiaSmiExitError{Code: exitErr.ExitCode(), Output: output}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run nvidia-smi: %w", err)
+	}
+
+	if stderr := strings.TrimSpace(errb.String()); stderr != "" {
+		log.Println("nvidia-smi warning:", stderr)
+	}
+
+	results, err := parseNvidiaSmiLog(outb.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSnapshot(results, time.Now()), nil
+}
+
+func parseNvidiaSmiLog(data []byte) (*NvidiaSmiLog, error) {
+	var results NvidiaSmiLog
+	err := xml.Unmarshal(data, &results)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedXML, err)
+	}
+	normalizeLegacyFields(&results)
+
+	return &results, nil
+}
+
+// normalizeLegacyFields copies readings that older drivers report under
+// different element names into the fields used by the rest of the bot.
+func normalizeLegacyFields(results *NvidiaSmiLog) {
+	for i := range results.Gpu {
+		gpu := &results.Gpu[i]
+
+		if gpu.GpuPowerReadings.PowerDraw == "" && gpu.PowerReadings.PowerDraw != "" {
+			legacy := gpu.PowerReadings
+			gpu.GpuPowerReadings.PowerState = legacy.PowerState
+			gpu.GpuPowerReadings.PowerDraw = legacy.PowerDraw
+			gpu.GpuPowerReadings.CurrentPowerLimit = legacy.EnforcedPowerLimit
+			gpu.GpuPowerReadings.RequestedPowerLimit = legacy.PowerLimit
+			gpu.GpuPowerReadings.DefaultPowerLimit = legacy.DefaultPowerLimit
+			gpu.GpuPowerReadings.MinPowerLimit = legacy.MinPowerLimit
+			gpu.GpuPowerReadings.MaxPowerLimit = legacy.MaxPowerLimit
+		}
+
+		if gpu.ClocksEventReasons.ClocksEventReasonGpuIdle == "" && gpu.ClocksThrottleReasons.ClocksThrottleReasonGpuIdle != "" {
+			legacy := gpu.ClocksThrottleReasons
+			gpu.ClocksEventReasons.ClocksEventReasonGpuIdle = legacy.ClocksThrottleReasonGpuIdle
+			gpu.ClocksEventReasons.ClocksEventReasonApplicationsClocksSetting = legacy.ClocksThrottleReasonApplicationsClocksSetting
+			gpu.ClocksEventReasons.ClocksEventReasonSwPowerCap = legacy.ClocksThrottleReasonSwPowerCap
+			gpu.ClocksEventReasons.ClocksEventReasonHwSlowdown = legacy.ClocksThrottleReasonHwSlowdown
+			gpu.ClocksEventReasons.ClocksEventReasonHwThermalSlowdown = legacy.ClocksThrottleReasonHwThermalSlowdown
+			gpu.ClocksEventReasons.ClocksEventReasonHwPowerBrakeSlowdown = legacy.ClocksThrottleReasonHwPowerBrakeSlowdown
+			gpu.ClocksEventReasons.ClocksEventReasonSyncBoost = legacy.ClocksThrottleReasonSyncBoost
+			gpu.ClocksEventReasons.ClocksEventReasonSwThermalSlowdown = legacy.ClocksThrottleReasonSwThermalSlowdown
+			gpu.ClocksEventReasons.ClocksEventReasonDisplayClocksSetting = legacy.ClocksThrottleReasonDisplayClocksSetting
+		}
+
+		// Before R510, correctable errors are single bit and uncorrectable ones double bit errors; device memory
+		// is the DRAM and every other location SRAM.
+		if volatile := &gpu.EccErrors.Volatile; volatile.DramCorrectable == "" && volatile.SingleBit.Total != "" {
+			volatile.DramCorrectable = volatile.SingleBit.DeviceMemory
+			volatile.DramUncorrectable = volatile.DoubleBit.DeviceMemory
+			volatile.SramCorrectable = legacySRAMCount(volatile.SingleBit)
+			volatile.SramUncorrectable = legacySRAMCount(volatile.DoubleBit)
+		}
+		if aggregate := &gpu.EccErrors.Aggregate; aggregate.DramCorrectable == "" && aggregate.SingleBit.Total != "" {
+			aggregate.DramCorrectable = aggregate.SingleBit.DeviceMemory
+			aggregate.DramUncorrectable = aggregate.DoubleBit.DeviceMemory
+			aggregate.SramCorrectable = legacySRAMCount(aggregate.SingleBit)
+			aggregate.SramUncorrectable = legacySRAMCount(aggregate.DoubleBit)
+		}
+	}
+}
+
+// legacyEccCounts is an ECC error counter of drivers before R510, split by memory location.
+type legacyEccCounts struct {
+	DeviceMemory string `xml:"device_memory"`
+	Total        string `xml:"total"`
+}
+
+// legacySRAMCount is the count of errors outside the device memory, or N/A when it cannot be told.
+func legacySRAMCount(counts legacyEccCounts) string {
+	total, err := strconv.Atoi(strings.TrimSpace(counts.Total))
+	if err != nil {
+		return "N/A"
+	}
+	dram, err := strconv.Atoi(strings.TrimSpace(counts.DeviceMemory))
+	if err != nil {
+		return "N/A"
+	}
+	return strconv.Itoa(total - dram)
+}
+
+// NvidiaSmiLog was generated 2024-07-24 14:58:41 by https://xml-to-go.github.io/ in Ukraine.
+type NvidiaSmiLog struct {
+	XMLName       xml.Name       `xml:"nvidia_smi_log"`
+	Text          string         `xml:",chardata"`
+	Timestamp     string         `xml:"timestamp"`
+	DriverVersion string         `xml:"driver_version"`
+	CudaVersion   string         `xml:"cuda_version"`
+	AttachedGpus  string         `xml:"attached_gpus"`
+	Gpu           []NvidiaSmiGpu `xml:"gpu"`
+}
+
+// NvidiaSmiGpu is a single <gpu> element of NvidiaSmiLog.
+type NvidiaSmiGpu struct {
+	Text                string `xml:",chardata"`
+	ID                  string `xml:"id,attr"`
+	ProductName         string `xml:"product_name"`
+	ProductBrand        string `xml:"product_brand"`
+	ProductArchitecture string `xml:"product_architecture"`
+	DisplayMode         string `xml:"display_mode"`
+	DisplayActive       string `xml:"display_active"`
+	PersistenceMode     string `xml:"persistence_mode"`
+	AddressingMode      string `xml:"addressing_mode"`
+	MigMode             struct {
+		Text       string `xml:",chardata"`
+		CurrentMig string `xml:"current_mig"`
+		PendingMig string `xml:"pending_mig"`
+	} `xml:"mig_mode"`
+	MigDevices               string `xml:"mig_devices"`
+	AccountingMode           string `xml:"accounting_mode"`
+	AccountingModeBufferSize string `xml:"accounting_mode_buffer_size"`
+	DriverModel              struct {
+		Text      string `xml:",chardata"`
+		CurrentDm string `xml:"current_dm"`
+		PendingDm string `xml:"pending_dm"`
+	} `xml:"driver_model"`
+	Serial           string `xml:"serial"`
+	Uuid             string `xml:"uuid"`
+	MinorNumber      string `xml:"minor_number"`
+	VbiosVersion     string `xml:"vbios_version"`
+	MultigpuBoard    string `xml:"multigpu_board"`
+	BoardID          string `xml:"board_id"`
+	BoardPartNumber  string `xml:"board_part_number"`
+	GpuPartNumber    string `xml:"gpu_part_number"`
+	GpuFruPartNumber string `xml:"gpu_fru_part_number"`
+	GpuModuleID      string `xml:"gpu_module_id"`
+	InforomVersion   struct {
+		Text       string `xml:",chardata"`
+		ImgVersion string `xml:"img_version"`
+		OemObject  string `xml:"oem_object"`
+		EccObject  string `xml:"ecc_object"`
+		PwrObject  string `xml:"pwr_object"`
+	} `xml:"inforom_version"`
+	InforomBbxFlush struct {
+		Text            string `xml:",chardata"`
+		LatestTimestamp string `xml:"latest_timestamp"`
+		LatestDuration  string `xml:"latest_duration"`
+	} `xml:"inforom_bbx_flush"`
+	GpuOperationMode struct {
+		Text       string `xml:",chardata"`
+		CurrentGom string `xml:"current_gom"`
+		PendingGom string `xml:"pending_gom"`
+	} `xml:"gpu_operation_mode"`
+	C2cMode               string `xml:"c2c_mode"`
+	GpuVirtualizationMode struct {
+		Text                  string `xml:",chardata"`
+		VirtualizationMode    string `xml:"virtualization_mode"`
+		HostVgpuMode          string `xml:"host_vgpu_mode"`
+		VgpuHeterogeneousMode string `xml:"vgpu_heterogeneous_mode"`
+	} `xml:"gpu_virtualization_mode"`
+	GpuResetStatus struct {
+		Text                     string `xml:",chardata"`
+		ResetRequired            string `xml:"reset_required"`
+		DrainAndResetRecommended string `xml:"drain_and_reset_recommended"`
+	} `xml:"gpu_reset_status"`
+	GspFirmwareVersion string `xml:"gsp_firmware_version"`
+	Ibmnpu             struct {
+		Text                string `xml:",chardata"`
+		RelaxedOrderingMode string `xml:"relaxed_ordering_mode"`
+	} `xml:"ibmnpu"`
+	Pci struct {
+		Text           string `xml:",chardata"`
+		PciBus         string `xml:"pci_bus"`
+		PciDevice      string `xml:"pci_device"`
+		PciDomain      string `xml:"pci_domain"`
+		PciBaseClass   string `xml:"pci_base_class"`
+		PciSubClass    string `xml:"pci_sub_class"`
+		PciDeviceID    string `xml:"pci_device_id"`
+		PciBusID       string `xml:"pci_bus_id"`
+		PciSubSystemID string `xml:"pci_sub_system_id"`
+		PciGpuLinkInfo struct {
+			Text    string `xml:",chardata"`
+			PcieGen struct {
+				Text                 string `xml:",chardata"`
+				MaxLinkGen           string `xml:"max_link_gen"`
+				CurrentLinkGen       string `xml:"current_link_gen"`
+				DeviceCurrentLinkGen string `xml:"device_current_link_gen"`
+				MaxDeviceLinkGen     string `xml:"max_device_link_gen"`
+				MaxHostLinkGen       string `xml:"max_host_link_gen"`
+			} `xml:"pcie_gen"`
+			LinkWidths struct {
+				Text             string `xml:",chardata"`
+				MaxLinkWidth     string `xml:"max_link_width"`
+				CurrentLinkWidth string `xml:"current_link_width"`
+			} `xml:"link_widths"`
+		} `xml:"pci_gpu_link_info"`
+		PciBridgeChip struct {
+			Text           string `xml:",chardata"`
+			BridgeChipType string `xml:"bridge_chip_type"`
+			BridgeChipFw   string `xml:"bridge_chip_fw"`
+		} `xml:"pci_bridge_chip"`
+		ReplayCounter         string `xml:"replay_counter"`
+		ReplayRolloverCounter string `xml:"replay_rollover_counter"`
+		TxUtil                string `xml:"tx_util"`
+		RxUtil                string `xml:"rx_util"`
+		AtomicCapsInbound     string `xml:"atomic_caps_inbound"`
+		AtomicCapsOutbound    string `xml:"atomic_caps_outbound"`
+	} `xml:"pci"`
+	FanSpeed           string `xml:"fan_speed"`
+	PerformanceState   string `xml:"performance_state"`
+	ClocksEventReasons struct {
+		Text                                       string `xml:",chardata"`
+		ClocksEventReasonGpuIdle                   string `xml:"clocks_event_reason_gpu_idle"`
+		ClocksEventReasonApplicationsClocksSetting string `xml:"clocks_event_reason_applications_clocks_setting"`
+		ClocksEventReasonSwPowerCap                string `xml:"clocks_event_reason_sw_power_cap"`
+		ClocksEventReasonHwSlowdown                string `xml:"clocks_event_reason_hw_slowdown"`
+		ClocksEventReasonHwThermalSlowdown         string `xml:"clocks_event_reason_hw_thermal_slowdown"`
+		ClocksEventReasonHwPowerBrakeSlowdown      string `xml:"clocks_event_reason_hw_power_brake_slowdown"`
+		ClocksEventReasonSyncBoost                 string `xml:"clocks_event_reason_sync_boost"`
+		ClocksEventReasonSwThermalSlowdown         string `xml:"clocks_event_reason_sw_thermal_slowdown"`
+		ClocksEventReasonDisplayClocksSetting      string `xml:"clocks_event_reason_display_clocks_setting"`
+	} `xml:"clocks_event_reasons"`
+	// ClocksThrottleReasons is reported instead of ClocksEventReasons by drivers before R535.
+	ClocksThrottleReasons struct {
+		Text                                          string `xml:",chardata"`
+		ClocksThrottleReasonGpuIdle                   string `xml:"clocks_throttle_reason_gpu_idle"`
+		ClocksThrottleReasonApplicationsClocksSetting string `xml:"clocks_throttle_reason_applications_clocks_setting"`
+		ClocksThrottleReasonSwPowerCap                string `xml:"clocks_throttle_reason_sw_power_cap"`
+		ClocksThrottleReasonHwSlowdown                string `xml:"clocks_throttle_reason_hw_slowdown"`
+		ClocksThrottleReasonHwThermalSlowdown         string `xml:"clocks_throttle_reason_hw_thermal_slowdown"`
+		ClocksThrottleReasonHwPowerBrakeSlowdown      string `xml:"clocks_throttle_reason_hw_power_brake_slowdown"`
+		ClocksThrottleReasonSyncBoost                 string `xml:"clocks_throttle_reason_sync_boost"`
+		ClocksThrottleReasonSwThermalSlowdown         string `xml:"clocks_throttle_reason_sw_thermal_slowdown"`
+		ClocksThrottleReasonDisplayClocksSetting      string `xml:"clocks_throttle_reason_display_clocks_setting"`
+	} `xml:"clocks_throttle_reasons"`
+	SparseOperationMode string `xml:"sparse_operation_mode"`
+	FbMemoryUsage       struct {
+		Text     string `xml:",chardata"`
+		Total    string `xml:"total"`
+		Reserved string `xml:"reserved"`
+		Used     string `xml:"used"`
+		Free     string `xml:"free"`
+	} `xml:"fb_memory_usage"`
+	Bar1MemoryUsage struct {
+		Text  string `xml:",chardata"`
+		Total string `xml:"total"`
+		Used  string `xml:"used"`
+		Free  string `xml:"free"`
+	} `xml:"bar1_memory_usage"`
+	CcProtectedMemoryUsage struct {
+		Text  string `xml:",chardata"`
+		Total string `xml:"total"`
+		Used  string `xml:"used"`
+		Free  string `xml:"free"`
+	} `xml:"cc_protected_memory_usage"`
+	ComputeMode string `xml:"compute_mode"`
+	Utilization struct {
+		Text        string `xml:",chardata"`
+		GpuUtil     string `xml:"gpu_util"`
+		MemoryUtil  string `xml:"memory_util"`
+		EncoderUtil string `xml:"encoder_util"`
+		DecoderUtil string `xml:"decoder_util"`
+		JpegUtil    string `xml:"jpeg_util"`
+		OfaUtil     string `xml:"ofa_util"`
+	} `xml:"utilization"`
+	EncoderStats struct {
+		Text           string `xml:",chardata"`
+		SessionCount   string `xml:"session_count"`
+		AverageFps     string `xml:"average_fps"`
+		AverageLatency string `xml:"average_latency"`
+	} `xml:"encoder_stats"`
+	FbcStats struct {
+		Text           string `xml:",chardata"`
+		SessionCount   string `xml:"session_count"`
+		AverageFps     string `xml:"average_fps"`
+		AverageLatency string `xml:"average_latency"`
+	} `xml:"fbc_stats"`
+	EccMode struct {
+		Text       string `xml:",chardata"`
+		CurrentEcc string `xml:"current_ecc"`
+		PendingEcc string `xml:"pending_ecc"`
+	} `xml:"ecc_mode"`
+	EccErrors struct {
+		Text     string `xml:",chardata"`
+		Volatile struct {
+			Text                    string `xml:",chardata"`
+			SramCorrectable         string `xml:"sram_correctable"`
+			SramUncorrectableParity string `xml:"sram_uncorrectable_parity"`
+			SramUncorrectableSecded string `xml:"sram_uncorrectable_secded"`
+			// SramUncorrectable is reported instead of the parity/SEC-DED split by drivers before R550.
+			SramUncorrectable string `xml:"sram_uncorrectable"`
+			DramCorrectable   string `xml:"dram_correctable"`
+			DramUncorrectable string `xml:"dram_uncorrectable"`
+			// SingleBit and DoubleBit are reported instead of the SRAM/DRAM split by drivers before R510.
+			SingleBit legacyEccCounts `xml:"single_bit"`
+			DoubleBit legacyEccCounts `xml:"double_bit"`
+		} `xml:"volatile"`
+		Aggregate struct {
+			Text                    string `xml:",chardata"`
+			SramCorrectable         string `xml:"sram_correctable"`
+			SramUncorrectableParity string `xml:"sram_uncorrectable_parity"`
+			SramUncorrectableSecded string `xml:"sram_uncorrectable_secded"`
+			// SramUncorrectable is reported instead of the parity/SEC-DED split by drivers before R550.
+			SramUncorrectable     string `xml:"sram_uncorrectable"`
+			DramCorrectable       string `xml:"dram_correctable"`
+			DramUncorrectable     string `xml:"dram_uncorrectable"`
+			SramThresholdExceeded string `xml:"sram_threshold_exceeded"`
+			// SingleBit and DoubleBit are reported instead of the SRAM/DRAM split by drivers before R510.
+			SingleBit legacyEccCounts `xml:"single_bit"`
+			DoubleBit legacyEccCounts `xml:"double_bit"`
+		} `xml:"aggregate"`
+		AggregateUncorrectableSramSources struct {
+			Text                string `xml:",chardata"`
+			SramL2              string `xml:"sram_l2"`
+			SramSm              string `xml:"sram_sm"`
+			SramMicrocontroller string `xml:"sram_microcontroller"`
+			SramPcie            string `xml:"sram_pcie"`
+			SramOther           string `xml:"sram_other"`
+		} `xml:"aggregate_uncorrectable_sram_sources"`
+	} `xml:"ecc_errors"`
+	RetiredPages struct {
+		Text                        string `xml:",chardata"`
+		MultipleSingleBitRetirement struct {
+			Text            string `xml:",chardata"`
+			RetiredCount    string `xml:"retired_count"`
+			RetiredPagelist string `xml:"retired_pagelist"`
+		} `xml:"multiple_single_bit_retirement"`
+		DoubleBitRetirement struct {
+			Text            string `xml:",chardata"`
+			RetiredCount    string `xml:"retired_count"`
+			RetiredPagelist string `xml:"retired_pagelist"`
+		} `xml:"double_bit_retirement"`
+		PendingBlacklist  string `xml:"pending_blacklist"`
+		PendingRetirement string `xml:"pending_retirement"`
+	} `xml:"retired_pages"`
+	RemappedRows struct {
+		Text                 string `xml:",chardata"`
+		RemappedRowCorr      string `xml:"remapped_row_corr"`
+		RemappedRowUnc       string `xml:"remapped_row_unc"`
+		RemappedRowPending   string `xml:"remapped_row_pending"`
+		RemappedRowFailure   string `xml:"remapped_row_failure"`
+		RowRemapperHistogram struct {
+			Text                        string `xml:",chardata"`
+			RowRemapperHistogramMax     string `xml:"row_remapper_histogram_max"`
+			RowRemapperHistogramHigh    string `xml:"row_remapper_histogram_high"`
+			RowRemapperHistogramPartial string `xml:"row_remapper_histogram_partial"`
+			RowRemapperHistogramLow     string `xml:"row_remapper_histogram_low"`
+			RowRemapperHistogramNone    string `xml:"row_remapper_histogram_none"`
+		} `xml:"row_remapper_histogram"`
+	} `xml:"remapped_rows"`
+	Temperature struct {
+		Text                   string `xml:",chardata"`
+		GpuTemp                string `xml:"gpu_temp"`
+		GpuTempTlimit          string `xml:"gpu_temp_tlimit"`
+		GpuTempMaxThreshold    string `xml:"gpu_temp_max_threshold"`
+		GpuTempSlowThreshold   string `xml:"gpu_temp_slow_threshold"`
+		GpuTempMaxGpuThreshold string `xml:"gpu_temp_max_gpu_threshold"`
+		GpuTargetTemperature   string `xml:"gpu_target_temperature"`
+		MemoryTemp             string `xml:"memory_temp"`
+		GpuTempMaxMemThreshold string `xml:"gpu_temp_max_mem_threshold"`
+	} `xml:"temperature"`
+	SupportedGpuTargetTemp struct {
+		Text             string `xml:",chardata"`
+		GpuTargetTempMin string `xml:"gpu_target_temp_min"`
+		GpuTargetTempMax string `xml:"gpu_target_temp_max"`
+	} `xml:"supported_gpu_target_temp"`
+	GpuPowerReadings struct {
+		Text                string `xml:",chardata"`
+		PowerState          string `xml:"power_state"`
+		PowerDraw           string `xml:"power_draw"`
+		CurrentPowerLimit   string `xml:"current_power_limit"`
+		RequestedPowerLimit string `xml:"requested_power_limit"`
+		DefaultPowerLimit   string `xml:"default_power_limit"`
+		MinPowerLimit       string `xml:"min_power_limit"`
+		MaxPowerLimit       string `xml:"max_power_limit"`
+	} `xml:"gpu_power_readings"`
+	// PowerReadings is reported instead of GpuPowerReadings by drivers before R530.
+	PowerReadings struct {
+		Text               string `xml:",chardata"`
+		PowerState         string `xml:"power_state"`
+		PowerManagement    string `xml:"power_management"`
+		PowerDraw          string `xml:"power_draw"`
+		PowerLimit         string `xml:"power_limit"`
+		DefaultPowerLimit  string `xml:"default_power_limit"`
+		EnforcedPowerLimit string `xml:"enforced_power_limit"`
+		MinPowerLimit      string `xml:"min_power_limit"`
+		MaxPowerLimit      string `xml:"max_power_limit"`
+	} `xml:"power_readings"`
+	GpuMemoryPowerReadings struct {
+		Text      string `xml:",chardata"`
+		PowerDraw string `xml:"power_draw"`
+	} `xml:"gpu_memory_power_readings"`
+	ModulePowerReadings struct {
+		Text                string `xml:",chardata"`
+		PowerState          string `xml:"power_state"`
+		PowerDraw           string `xml:"power_draw"`
+		CurrentPowerLimit   string `xml:"current_power_limit"`
+		RequestedPowerLimit string `xml:"requested_power_limit"`
+		DefaultPowerLimit   string `xml:"default_power_limit"`
+		MinPowerLimit       string `xml:"min_power_limit"`
+		MaxPowerLimit       string `xml:"max_power_limit"`
+	} `xml:"module_power_readings"`
+	Clocks struct {
+		Text          string `xml:",chardata"`
+		GraphicsClock string `xml:"graphics_clock"`
+		SmClock       string `xml:"sm_clock"`
+		MemClock      string `xml:"mem_clock"`
+		VideoClock    string `xml:"video_clock"`
+	} `xml:"clocks"`
+	ApplicationsClocks struct {
+		Text          string `xml:",chardata"`
+		GraphicsClock string `xml:"graphics_clock"`
+		MemClock      string `xml:"mem_clock"`
+	} `xml:"applications_clocks"`
+	DefaultApplicationsClocks struct {
+		Text          string `xml:",chardata"`
+		GraphicsClock string `xml:"graphics_clock"`
+		MemClock      string `xml:"mem_clock"`
+	} `xml:"default_applications_clocks"`
+	DeferredClocks struct {
+		Text     string `xml:",chardata"`
+		MemClock string `xml:"mem_clock"`
+	} `xml:"deferred_clocks"`
+	MaxClocks struct {
+		Text          string `xml:",chardata"`
+		GraphicsClock string `xml:"graphics_clock"`
+		SmClock       string `xml:"sm_clock"`
+		MemClock      string `xml:"mem_clock"`
+		VideoClock    string `xml:"video_clock"`
+	} `xml:"max_clocks"`
+	MaxCustomerBoostClocks struct {
+		Text          string `xml:",chardata"`
+		GraphicsClock string `xml:"graphics_clock"`
+	} `xml:"max_customer_boost_clocks"`
+	ClockPolicy struct {
+		Text             string `xml:",chardata"`
+		AutoBoost        string `xml:"auto_boost"`
+		AutoBoostDefault string `xml:"auto_boost_default"`
+	} `xml:"clock_policy"`
+	Voltage struct {
+		Text         string `xml:",chardata"`
+		GraphicsVolt string `xml:"graphics_volt"`
+	} `xml:"voltage"`
+	Fabric struct {
+		Text        string `xml:",chardata"`
+		State       string `xml:"state"`
+		Status      string `xml:"status"`
+		CliqueId    string `xml:"cliqueId"`
+		ClusterUuid string `xml:"clusterUuid"`
+		Health      struct {
+			Text      string `xml:",chardata"`
+			Bandwidth string `xml:"bandwidth"`
+		} `xml:"health"`
+	} `xml:"fabric"`
+	SupportedClocks struct {
+		Text              string `xml:",chardata"`
+		SupportedMemClock []struct {
+			Text                   string   `xml:",chardata"`
+			Value                  string   `xml:"value"`
+			SupportedGraphicsClock []string `xml:"supported_graphics_clock"`
+		} `xml:"supported_mem_clock"`
+	} `xml:"supported_clocks"`
+	Processes struct {
+		Text        string `xml:",chardata"`
+		ProcessInfo []struct {
+			Text              string `xml:",chardata"`
+			GpuInstanceID     string `xml:"gpu_instance_id"`
+			ComputeInstanceID string `xml:"compute_instance_id"`
+			Pid               string `xml:"pid"`
+			Type              string `xml:"type"`
+			ProcessName       string `xml:"process_name"`
+			UsedMemory        string `xml:"used_memory"`
+		} `xml:"process_info"`
+	} `xml:"processes"`
+	AccountedProcesses string `xml:"accounted_processes"`
+	Capabilities       struct {
+		Text string `xml:",chardata"`
+		Egm  string `xml:"egm"`
+	} `xml:"capabilities"`
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var fixtures = []string{"470", "535", "555"}
+
+func loadFixture(t *testing.T, driver string) *Snapshot {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "nvidia-smi-"+driver+".xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := parseNvidiaSmiLog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSnapshot(results, time.Date(2024, 7, 24, 15, 34, 38, 0, time.UTC))
+}
+
+func TestParseNvidiaSmiLog(t *testing.T) {
+	tests := []struct {
+		driver        string
+		driverVersion string
+		cudaVersion   string
+		gpus          int
+		id            string
+		productName   string
+		memoryUsed    string
+		powerDraw     string
+		powerLimit    string
+		gpuIdle       string
+		processes     int
+	}{
+		{"470", "470.161.03", "11.4", 1, "00000000:3B:00.0", "Tesla V100-PCIE-32GB", "28904 MiB", "212.73 W", "250.00 W", "Not Active", 1},
+		{"535", "535.129.03", "12.2", 2, "00000000:07:00.0", "NVIDIA A100-SXM4-80GB", "20480 MiB", "61.27 W", "400.00 W", "Active", 1},
+		{"555", "555.42.06", "12.5", 2, "00000000:02:00.0", "NVIDIA RTX A4000", "14551 MiB", "124.19 W", "140.00 W", "Not Active", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			results := loadFixture(t, tt.driver).Log
+
+			if results.DriverVersion != tt.driverVersion {
+				t.Errorf("DriverVersion = %q, want %q", results.DriverVersion, tt.driverVersion)
+			}
+			if results.CudaVersion != tt.cudaVersion {
+				t.Errorf("CudaVersion = %q, want %q", results.CudaVersion, tt.cudaVersion)
+			}
+			if len(results.Gpu) != tt.gpus {
+				t.Fatalf("len(Gpu) = %d, want %d", len(results.Gpu), tt.gpus)
+			}
+
+			gpu := results.Gpu[0]
+			if gpu.ID != tt.id {
+				t.Errorf("ID = %q, want %q", gpu.ID, tt.id)
+			}
+			if gpu.ProductName != tt.productName {
+				t.Errorf("ProductName = %q, want %q", gpu.ProductName, tt.productName)
+			}
+			if gpu.FbMemoryUsage.Used != tt.memoryUsed {
+				t.Errorf("FbMemoryUsage.Used = %q, want %q", gpu.FbMemoryUsage.Used, tt.memoryUsed)
+			}
+			if gpu.GpuPowerReadings.PowerDraw != tt.powerDraw {
+				t.Errorf("GpuPowerReadings.PowerDraw = %q, want %q", gpu.GpuPowerReadings.PowerDraw, tt.powerDraw)
+			}
+			if gpu.GpuPowerReadings.CurrentPowerLimit != tt.powerLimit {
+				t.Errorf("GpuPowerReadings.CurrentPowerLimit = %q, want %q", gpu.GpuPowerReadings.CurrentPowerLimit, tt.powerLimit)
+			}
+			if gpu.ClocksEventReasons.ClocksEventReasonGpuIdle != tt.gpuIdle {
+				t.Errorf("ClocksEventReasonGpuIdle = %q, want %q", gpu.ClocksEventReasons.ClocksEventReasonGpuIdle, tt.gpuIdle)
+			}
+			if len(gpu.Processes.ProcessInfo) != tt.processes {
+				t.Errorf("len(ProcessInfo) = %d, want %d", len(gpu.Processes.ProcessInfo), tt.processes)
+			}
+		})
+	}
+}
+
+func TestParseNvidiaSmiLogMalformed(t *testing.T) {
+	_, err := parseNvidiaSmiLog([]byte("<nvidia_smi_log><gpu>"))
+	if err == nil {
+		t.Fatal("expected an error for truncated xml")
+	}
+}
+
+// fakeNvidiaSmi writes a shell script that stands in for nvidia-smi.
+func fakeNvidiaSmi(t *testing.T, script string) *NvidiaSmiCollector {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "nvidia-smi")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &NvidiaSmiCollector{Binary: path, Timeout: 200 * time.Millisecond}
+}
+
+func TestNvidiaSmiCollector(t *testing.T) {
+	fixture, err := filepath.Abs(filepath.Join("testdata", "nvidia-smi-555.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := fakeNvidiaSmi(t, "echo 'WARNING: infoROM is corrupted' >&2\ncat "+fixture)
+	s, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.GPUs) != 2 {
+		t.Errorf("got %d GPUs, want 2", len(s.GPUs))
+	}
+}
+
+func TestNvidiaSmiCollectorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   error
+	}{
+		{"driver not loaded", "echo \"NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver.\"\nexit 9", ErrDriverNotLoaded},
+		{"timeout", "sleep 5 &\nsleep 5", ErrNvidiaSmiTimeout},
+		{"malformed xml", "echo '<nvidia_smi_log><gpu>'", ErrMalformedXML},
+		{"no output", "", ErrMalformedXML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := fakeNvidiaSmi(t, tt.script).Collect(context.Background())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Collect() = %v, want %v", err, tt.want)
+			}
+			// The whole process group is killed, so a lingering child does not hold up the result.
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Collect() took %s", elapsed)
+			}
+		})
+	}
+
+	_, err := fakeNvidiaSmi(t, "echo 'Unable to determine the device handle' >&2\nexit 15").Collect(context.Background())
+	var exitErr *NvidiaSmiExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 15 || exitErr.Output != "Unable to determine the device handle" {
+		t.Errorf("Collect() = %v, want exit code 15 with stderr", err)
+	}
+
+	_, err = (&NvidiaSmiCollector{Binary: "nvidia-smi-does-not-exist"}).Collect(context.Background())
+	if !errors.Is(err, ErrNoNvidiaSmi) {
+		t.Errorf("Collect() = %v, want ErrNoNvidiaSmi", err)
+	}
+}
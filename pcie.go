@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// defaultMaxReplaysPerHour is how fast the PCIe replay counter may grow before an alert.
+	defaultMaxReplaysPerHour = 100
+	// pcieReplayWindow is how long the replay counter is watched before its rate is judged, so that a few
+	// replays in a single sample do not look like a storm.
+	pcieReplayWindow = 10 * time.Minute
+	// pcieStateKey is where the store keeps the PCIe link state of the GPUs.
+	pcieStateKey = "pcie_links"
+)
+
+// linkDegraded describes how the current PCIe link of a GPU falls short of its maximum, or returns "" when it does not.
+func linkDegraded(gpu GPU) string {
+	var short []string
+	if gpu.PCIeGen.OK() && gpu.PCIeMaxGen.OK() && gpu.PCIeGen.Value < gpu.PCIeMaxGen.Value {
+		short = append(short, fmt.Sprintf("Gen%s of Gen%s", gpu.PCIeGen, gpu.PCIeMaxGen))
+	}
+	if gpu.PCIeWidth.OK() && gpu.PCIeMaxWidth.OK() && gpu.PCIeWidth.Value < gpu.PCIeMaxWidth.Value {
+		short = append(short, fmt.Sprintf("%s of %s", linkWidth(gpu.PCIeWidth), linkWidth(gpu.PCIeMaxWidth)))
+	}
+	return strings.Join(short, ", ")
+}
+
+// renderPCIe renders the PCIe link of every GPU.
+func renderPCIe(s *Snapshot) string {
+	blocks := make([]string, 0, len(s.GPUs))
+	for _, gpu := range s.GPUs {
+		lines := []string{
+			fmt.Sprintf("<b>%s</b>", gpuLabel(gpu)),
+			fmt.Sprintf("Link: <b>Gen%s %s</b> of Gen%s %s at %s utilization",
+				gpu.PCIeGen, linkWidth(gpu.PCIeWidth), gpu.PCIeMaxGen, linkWidth(gpu.PCIeMaxWidth), gpu.GPUUtil),
+			fmt.Sprintf("Replays: <b>%s</b>, rollovers %s", gpu.PCIeReplays, gpu.PCIeReplayRollovers),
+		}
+		if short := linkDegraded(gpu); short != "" {
+			// Idle GPUs lower the generation, but not the width.
+			busy := gpu.GPUUtil.OK() && gpu.GPUUtil.Value >= idleUtilization
+			narrow := gpu.PCIeWidth.OK() && gpu.PCIeMaxWidth.OK() && gpu.PCIeWidth.Value < gpu.PCIeMaxWidth.Value
+			if busy || narrow {
+				lines = append(lines, "• <b>degraded</b>: "+short+"; reseat the card or check the slot and riser")
+			} else {
+				lines = append(lines, "• "+short+", idle GPUs lower the link generation to save power")
+			}
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+// pcie handles /pcie and replies with the PCIe link of every GPU.
+func pcie(b *gotgbot.Bot, ctx *ext.Context) error {
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+
+	return replyHTML(b, ctx, truncateMessage(renderPCIe(snapshot), maxMessageLength))
+}
+
+// pcieLink is what the PCIeMonitor remembers about the link of a GPU.
+type pcieLink struct {
+	// Degraded is set once a busy GPU was alerted about a link below its maximum.
+	Degraded bool `json:"degraded"`
+	// ReplaysSince, Replays and Rollovers are the counters at the start of the current replay window.
+	ReplaysSince time.Time `json:"replays_since"`
+	Replays      float64   `json:"replays"`
+	Rollovers    float64   `json:"rollovers"`
+	// Storm is set while the replay counter grows faster than the limit.
+	Storm bool `json:"storm"`
+}
+
+// PCIeMonitor alerts when a busy GPU runs its PCIe link below the maximum generation or width, and when
+// the replay counter grows by more than MaxReplaysPerHour.
+type PCIeMonitor struct {
+	MaxReplaysPerHour float64
+
+	store *Store
+	links map[string]*pcieLink
+}
+
+// NewPCIeMonitor creates a monitor that continues with the link state saved in the store.
+func NewPCIeMonitor(maxReplaysPerHour float64, store *Store) *PCIeMonitor {
+	m := &PCIeMonitor{MaxReplaysPerHour: maxReplaysPerHour, store: store, links: make(map[string]*pcieLink)}
+	if _, err := store.Load(pcieStateKey, &m.links); err != nil {
+		log.Println("failed to load pcie links:", err.Error())
+	}
+
+	return m
+}
+
+func (m *PCIeMonitor) Observe(s *Snapshot) []Alert {
+	var alerts []Alert
+	changed := false
+
+	seen := make(map[string]bool)
+	for _, gpu := range s.GPUs {
+		seen[gpu.UUID] = true
+		link, ok := m.links[gpu.UUID]
+		if !ok {
+			link = &pcieLink{}
+			m.links[gpu.UUID] = link
+		}
+		before := *link
+
+		// Idle GPUs lower the link generation on purpose, so the link is only judged under load.
+		if busy := gpu.GPUUtil.OK() && gpu.GPUUtil.Value >= idleUtilization; busy {
+			short := linkDegraded(gpu)
+			switch {
+			case short != "" && !link.Degraded:
+				link.Degraded = true
+				alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>ALERT</b> %s: PCIe link is <b>%s</b> at %s utilization; reseat the card or check the slot and riser. See /pcie.",
+					gpuLabel(gpu), short, gpu.GPUUtil)})
+			case short == "" && link.Degraded:
+				link.Degraded = false
+				alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>RESOLVED</b> %s: PCIe link is back to Gen%s %s",
+					gpuLabel(gpu), gpu.PCIeGen, linkWidth(gpu.PCIeWidth))})
+			}
+		}
+
+		if alert, ok := m.observeReplays(gpu, link, s.CollectedAt); ok {
+			alerts = append(alerts, alert)
+		}
+		if *link != before {
+			changed = true
+		}
+	}
+	for uuid := range m.links {
+		if !seen[uuid] {
+			delete(m.links, uuid)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := m.store.Save(pcieStateKey, m.links); err != nil {
+			log.Println("failed to save pcie links:", err.Error())
+		}
+	}
+
+	return alerts
+}
+
+// observeReplays judges the replay rate once per pcieReplayWindow and starts the next window.
+func (m *PCIeMonitor) observeReplays(gpu GPU, link *pcieLink, now time.Time) (Alert, bool) {
+	if m.MaxReplaysPerHour <= 0 || !gpu.PCIeReplays.OK() {
+		return Alert{}, false
+	}
+	replays, rollovers := gpu.PCIeReplays.Value, gpu.PCIeReplayRollovers.Value
+
+	// A driver reload or reboot resets the counters.
+	if link.ReplaysSince.IsZero() || replays < link.Replays && rollovers <= link.Rollovers {
+		link.ReplaysSince, link.Replays, link.Rollovers = now, replays, rollovers
+		return Alert{}, false
+	}
+	elapsed := now.Sub(link.ReplaysSince)
+	if elapsed < pcieReplayWindow {
+		return Alert{}, false
+	}
+
+	grown := replays - link.Replays
+	perHour := grown / elapsed.Hours()
+	storm := perHour > m.MaxReplaysPerHour || rollovers > link.Rollovers
+	link.ReplaysSince, link.Replays, link.Rollovers = now, replays, rollovers
+
+	switch {
+	case storm && !link.Storm:
+		link.Storm = true
+		return Alert{Text: fmt.Sprintf("<b>ALERT</b> %s: PCIe replay counter grew by <b>%.0f</b> in %s (%.0f per hour, limit %.0f) on a Gen%s %s link; the link is unreliable, check the slot and riser. See /pcie.",
+			gpuLabel(gpu), grown, formatDuration(elapsed), perHour, m.MaxReplaysPerHour, gpu.PCIeGen, linkWidth(gpu.PCIeWidth))}, true
+	case !storm && link.Storm:
+		link.Storm = false
+		return Alert{Text: fmt.Sprintf("<b>RESOLVED</b> %s: PCIe replays are back to %.0f per hour", gpuLabel(gpu), perHour)}, true
+	}
+	return Alert{}, false
+}
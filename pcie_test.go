@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPCIe(t *testing.T) {
+	s := loadFixture(t, "555")
+	// GPU 1 runs at Gen1 x4 of Gen4 x16.
+	text := renderPCIe(s)
+	for _, want := range []string{
+		"Link: <b>Gen4 16x</b> of Gen4 16x at 39 % utilization",
+		"Replays: <b>12</b>, rollovers 0",
+		"• <b>degraded</b>: Gen1 of Gen4, 4x of 16x",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report does not contain %q:\n%s", want, text)
+		}
+	}
+
+	// An idle GPU lowers the generation on purpose.
+	s.GPUs[1].GPUUtil = Reading{Value: 0}
+	s.GPUs[1].PCIeWidth = s.GPUs[1].PCIeMaxWidth
+	if text := renderPCIe(s); strings.Contains(text, "degraded") || !strings.Contains(text, "• Gen1 of Gen4, idle GPUs") {
+		t.Errorf("idle GPU reported as degraded:\n%s", text)
+	}
+}
+
+func TestPCIeMonitorLink(t *testing.T) {
+	store := testStore(t)
+	s := loadFixture(t, "555")
+
+	m := NewPCIeMonitor(0, store)
+	alerts := m.Observe(s)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "<b>ALERT</b> GPU 1 (") || !strings.Contains(alerts[0].Text, "<b>Gen1 of Gen4, 4x of 16x</b> at 45 % utilization") {
+		t.Fatalf("expected an alert for GPU 1, got %v", alerts)
+	}
+
+	// A restart does not repeat the alert.
+	m = NewPCIeMonitor(0, store)
+	if alerts := m.Observe(s); len(alerts) != 0 {
+		t.Fatalf("alert repeated: %v", alerts)
+	}
+
+	// An idle GPU is not judged.
+	s.GPUs[1].GPUUtil = Reading{Value: 0}
+	if alerts := m.Observe(s); len(alerts) != 0 {
+		t.Fatalf("idle GPU judged: %v", alerts)
+	}
+
+	s.GPUs[1].GPUUtil = Reading{Value: 80}
+	s.GPUs[1].PCIeGen, s.GPUs[1].PCIeWidth = s.GPUs[1].PCIeMaxGen, s.GPUs[1].PCIeMaxWidth
+	alerts = m.Observe(s)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "<b>RESOLVED</b> GPU 1 (") || !strings.Contains(alerts[0].Text, "back to Gen4 16x") {
+		t.Fatalf("expected a resolved message, got %v", alerts)
+	}
+}
+
+func TestPCIeMonitorReplays(t *testing.T) {
+	s := loadFixture(t, "555")
+	start := s.CollectedAt
+	// Only the replay counter is watched here.
+	s.GPUs[1].PCIeGen, s.GPUs[1].PCIeWidth = s.GPUs[1].PCIeMaxGen, s.GPUs[1].PCIeMaxWidth
+
+	m := NewPCIeMonitor(100, testStore(t))
+	observe := func(after time.Duration, replays float64) []Alert {
+		s.CollectedAt = start.Add(after)
+		s.GPUs[1].PCIeReplays = Reading{Value: replays}
+		return m.Observe(s)
+	}
+
+	if alerts := observe(0, 12); len(alerts) != 0 {
+		t.Fatalf("alerted at once: %v", alerts)
+	}
+	// A burst within the window is not judged yet.
+	if alerts := observe(5*time.Minute, 40); len(alerts) != 0 {
+		t.Fatalf("alerted within the window: %v", alerts)
+	}
+	alerts := observe(10*time.Minute, 62)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "<b>ALERT</b> GPU 1 (") || !strings.Contains(alerts[0].Text, "grew by <b>50</b> in 10m0s (300 per hour, limit 100)") {
+		t.Fatalf("expected a replay alert, got %v", alerts)
+	}
+	if alerts := observe(20*time.Minute, 200); len(alerts) != 0 {
+		t.Fatalf("alert repeated: %v", alerts)
+	}
+	alerts = observe(30*time.Minute, 205)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "<b>RESOLVED</b> GPU 1 (") || !strings.Contains(alerts[0].Text, "back to 30 per hour") {
+		t.Fatalf("expected a resolved message, got %v", alerts)
+	}
+
+	// A driver reload resets the counter.
+	if alerts := observe(40*time.Minute, 0); len(alerts) != 0 {
+		t.Fatalf("alerted on a counter reset: %v", alerts)
+	}
+	if alerts := observe(50*time.Minute, 3); len(alerts) != 0 {
+		t.Fatalf("alerted after a counter reset: %v", alerts)
+	}
+}
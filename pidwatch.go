@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// pidWatchesKey is where the store keeps the /watch_pid requests.
+	pidWatchesKey = "pid_watches"
+	// pidLastSeenSaveInterval is how often the last sighting of a watched process is saved on its own, so that
+	// a running process does not rewrite the store at every poll.
+	pidLastSeenSaveInterval = 10 * time.Minute
+)
+
+// pidWatch is a /watch_pid request.
+type pidWatch struct {
+	ChatID  int64  `json:"chat_id"`
+	UserID  int64  `json:"user_id"`
+	User    string `json:"user"`
+	ReplyTo int64  `json:"reply_to"`
+
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+	// Owner is the Unix user running the process, if /proc shows it.
+	Owner string `json:"owner,omitempty"`
+	// Started is when the process started according to /proc; it tells the process from a later one with the same PID.
+	Started time.Time `json:"started,omitempty"`
+	Since   time.Time `json:"since"`
+
+	LastSeen time.Time `json:"last_seen"`
+	// PeakMemory is the most GPU memory in bytes the process held at once, summed over its GPUs.
+	PeakMemory float64 `json:"peak_memory"`
+	// GPUs are the indexes of the GPUs the process was seen on.
+	GPUs []int `json:"gpus"`
+
+	// savedLastSeen is LastSeen as it was last saved.
+	savedLastSeen time.Time
+}
+
+// see records a sample in which the process held memory on the GPUs and reports whether it should be saved:
+// when the process holds more memory or runs on another GPU than before, or was last saved long ago.
+func (w *pidWatch) see(at time.Time, gpus []int, memory float64) bool {
+	changed := at.Sub(w.savedLastSeen) >= pidLastSeenSaveInterval
+	w.LastSeen = at
+	if memory > w.PeakMemory {
+		w.PeakMemory = memory
+		changed = true
+	}
+	for _, index := range gpus {
+		if !slices.Contains(w.GPUs, index) {
+			w.GPUs = append(w.GPUs, index)
+			changed = true
+		}
+	}
+	slices.Sort(w.GPUs)
+	return changed
+}
+
+// runtime is how long the process ran until it was last seen, or since it was watched when its start is unknown.
+func (w *pidWatch) runtime() time.Duration {
+	if w.Started.IsZero() {
+		return w.LastSeen.Sub(w.Since)
+	}
+	return w.LastSeen.Sub(w.Started)
+}
+
+func (w *pidWatch) describe() string {
+	text := fmt.Sprintf("<code>%d</code> %s", w.PID, html.EscapeString(w.Name))
+	if w.Owner != "" {
+		text += fmt.Sprintf(" (%s)", html.EscapeString(w.Owner))
+	}
+	return text
+}
+
+// findProcess returns the GPUs the process runs on and the GPU memory it holds on all of them.
+func findProcess(s *Snapshot, pid int) (Process, []int, float64, bool) {
+	var found Process
+	var gpus []int
+	var memory float64
+	for _, gpu := range s.GPUs {
+		for _, process := range gpu.Processes {
+			if process.PID != pid {
+				continue
+			}
+			found = process
+			gpus = append(gpus, gpu.Index)
+			if process.UsedMemory.OK() {
+				memory += process.UsedMemory.Value
+			}
+		}
+	}
+	return found, gpus, memory, len(gpus) > 0
+}
+
+// PIDWatcher tells the chats when watched processes exit. It is an Observer fed by the poller.
+type PIDWatcher struct {
+	procs *ProcFS
+	store *Store
+
+	mu      sync.Mutex
+	watches []*pidWatch
+}
+
+// NewPIDWatcher creates a PIDWatcher with the requests saved in the store.
+func NewPIDWatcher(procs *ProcFS, store *Store) *PIDWatcher {
+	w := &PIDWatcher{procs: procs, store: store}
+	if _, err := store.Load(pidWatchesKey, &w.watches); err != nil {
+		log.Println("failed to load /watch_pid requests:", err.Error())
+	}
+
+	return w
+}
+
+// Add registers a request unless the chat watches the PID already, and reports whether it did.
+func (w *PIDWatcher) Add(watch *pidWatch) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if slices.ContainsFunc(w.watches, func(other *pidWatch) bool { return other.ChatID == watch.ChatID && other.PID == watch.PID }) {
+		return false
+	}
+	w.watches = append(w.watches, watch)
+	w.saveLocked()
+	return true
+}
+
+// List returns the requests of a chat.
+func (w *PIDWatcher) List(chatID int64) []pidWatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var watches []pidWatch
+	for _, watch := range w.watches {
+		if watch.ChatID == chatID {
+			watches = append(watches, *watch)
+		}
+	}
+	return watches
+}
+
+func (w *PIDWatcher) Observe(s *Snapshot) []Alert {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var alerts []Alert
+	changed := false
+	w.watches = slices.DeleteFunc(w.watches, func(watch *pidWatch) bool {
+		if _, gpus, memory, ok := findProcess(s, watch.PID); ok {
+			if watch.see(s.CollectedAt, gpus, memory) {
+				changed = true
+			}
+			return false
+		}
+		if !w.exited(watch) {
+			return false
+		}
+
+		changed = true
+		alerts = append(alerts, Alert{
+			ChatID:  watch.ChatID,
+			ReplyTo: watch.ReplyTo,
+			Text:    renderPIDExit(watch, s.CollectedAt),
+		})
+		return true
+	})
+	if changed {
+		w.saveLocked()
+	}
+
+	return alerts
+}
+
+// exited reports whether the process has left /proc as well, or the PID now belongs to another process.
+func (w *PIDWatcher) exited(watch *pidWatch) bool {
+	info, err := w.procs.Process(watch.PID, watch.Name)
+	switch {
+	case errors.Is(err, ErrProcessGone), errors.Is(err, ErrForeignPID):
+		return true
+	case err != nil:
+		log.Printf("failed to check watched process %d: %s\n", watch.PID, err)
+		return false
+	}
+	return !watch.Started.IsZero() && !info.Started.Equal(watch.Started)
+}
+
+func (w *PIDWatcher) saveLocked() {
+	if err := w.store.Save(pidWatchesKey, w.watches); err != nil {
+		log.Println("failed to save /watch_pid requests:", err.Error())
+		return
+	}
+	for _, watch := range w.watches {
+		watch.savedLastSeen = watch.LastSeen
+	}
+}
+
+func renderPIDExit(watch *pidWatch, now time.Time) string {
+	gpus := make([]string, len(watch.GPUs))
+	for i, index := range watch.GPUs {
+		gpus[i] = strconv.Itoa(index)
+	}
+
+	lines := []string{
+		fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>: process %s has <b>exited</b>.`, watch.UserID, html.EscapeString(watch.User), watch.describe()),
+		fmt.Sprintf("Runtime: <b>%s</b>", formatDuration(watch.runtime())),
+		fmt.Sprintf("Peak GPU memory: <b>%.1f GiB</b> on GPU %s", watch.PeakMemory/gib, strings.Join(gpus, ", ")),
+		fmt.Sprintf("Last seen at %s, gone at %s", watch.LastSeen.Format("Jan 2 15:04:05"), now.Format("Jan 2 15:04:05")),
+	}
+	if watch.Started.IsZero() {
+		lines[1] += " (since it was watched)"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pidWatcher is created in main once the store is open.
+var pidWatcher *PIDWatcher
+
+const watchPIDUsage = "Usage: /watch_pid <pid>"
+
+// watchPID handles /watch_pid <pid>. Only the owner of the process, as mapped in access.unix_users, and admins
+// may watch it. Without a pid it lists the watched processes of the chat.
+func watchPID(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+	if len(args) == 0 {
+		return replyHTML(b, ctx, renderPIDWatches(pidWatcher.List(ctx.EffectiveChat.Id)))
+	}
+	pid, err := strconv.Atoi(args[0])
+	if err != nil || pid <= 0 || len(args) > 1 {
+		return replyHTML(b, ctx, watchPIDUsage)
+	}
+
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+	process, gpus, memory, ok := findProcess(snapshot, pid)
+	if !ok {
+		return replyHTML(b, ctx, fmt.Sprintf("No GPU process has PID <code>%d</code>, see /processes.", pid))
+	}
+
+	sender := ctx.EffectiveSender.Id()
+	info, err := procFS.Process(pid, process.Name)
+	owner := err == nil && settings.Load().UnixUsers[sender] == info.User
+	if !owner && senderRole(ctx) < RoleAdmin {
+		if err != nil {
+			return replyHTML(b, ctx, fmt.Sprintf("The owner of <code>%d</code> is unknown, only admins can watch it.", pid))
+		}
+		return replyHTML(b, ctx, fmt.Sprintf("Only <b>%s</b> and admins can watch <code>%d</code>.", html.EscapeString(info.User), pid))
+	}
+
+	now := time.Now()
+	watch := &pidWatch{
+		ChatID:  ctx.EffectiveChat.Id,
+		UserID:  sender,
+		User:    ctx.EffectiveSender.Name(),
+		ReplyTo: ctx.EffectiveMessage.MessageId,
+		PID:     pid,
+		Name:    process.Name,
+		Owner:   info.User,
+		Started: info.Started,
+		Since:   now,
+	}
+	watch.see(snapshot.CollectedAt, gpus, memory)
+	if !pidWatcher.Add(watch) {
+		return replyHTML(b, ctx, fmt.Sprintf("<code>%d</code> is watched in this chat already.", pid))
+	}
+
+	return replyHTML(b, ctx, fmt.Sprintf("Watching %s, I will tell you when it exits.", watch.describe()))
+}
+
+func renderPIDWatches(watches []pidWatch) string {
+	if len(watches) == 0 {
+		return "No processes are watched in this chat.\n" + watchPIDUsage
+	}
+
+	lines := []string{"<b>Watched processes</b>"}
+	for _, watch := range watches {
+		lines = append(lines, fmt.Sprintf("%s for %s, up %s, peak %.1f GiB",
+			watch.describe(), html.EscapeString(watch.User), formatDuration(watch.runtime()), watch.PeakMemory/gib))
+	}
+	return strings.Join(lines, "\n")
+}
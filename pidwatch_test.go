@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPIDWatchSee(t *testing.T) {
+	start := time.Date(2024, 7, 24, 12, 0, 0, 0, time.UTC)
+	w := &pidWatch{}
+	steps := []struct {
+		after  time.Duration
+		gpus   []int
+		memory float64
+		save   bool
+	}{
+		{0, []int{0}, gib, true},
+		{time.Minute, []int{0}, gib, false},
+		{2 * time.Minute, []int{0}, 2 * gib, true},
+		{3 * time.Minute, []int{0, 1}, gib, true},
+		{4 * time.Minute, []int{1}, gib, false},
+		{3*time.Minute + pidLastSeenSaveInterval - time.Second, []int{0}, gib, false},
+		{3*time.Minute + pidLastSeenSaveInterval, []int{0}, gib, true},
+	}
+	for _, step := range steps {
+		if save := w.see(start.Add(step.after), step.gpus, step.memory); save != step.save {
+			t.Errorf("see after %s = %v, want %v", step.after, save, step.save)
+		}
+		if step.save {
+			w.savedLastSeen = w.LastSeen
+		}
+	}
+}
+
+func TestPIDWatcher(t *testing.T) {
+	store := testStore(t)
+	s := loadFixture(t, "555")
+	start := s.CollectedAt
+	started := time.Unix(1721800000+7200, 0)
+
+	w := NewPIDWatcher(testProcFS(), store)
+	w.Add(&pidWatch{ChatID: 1, UserID: 11, User: "Alice", ReplyTo: 5, PID: 412873, Name: "/home/alice/.venv/bin/python",
+		Owner: "alice", Started: started, Since: start})
+	// 500000 has no /proc entry, so it has exited once nvidia-smi stops listing it.
+	w.Add(&pidWatch{ChatID: 2, UserID: 12, User: "Bob", PID: 500000, Name: "python", Since: start})
+	if w.Add(&pidWatch{ChatID: 1, PID: 412873}) {
+		t.Error("the same PID was watched twice in a chat")
+	}
+
+	s.GPUs[1].Processes = append(s.GPUs[1].Processes, Process{PID: 500000, Name: "python", UsedMemory: Reading{Value: 2 * gib}})
+	if alerts := w.Observe(s); len(alerts) != 0 {
+		t.Fatalf("alerted while the processes run: %v", alerts)
+	}
+
+	// The requests and their peak memory survive a restart.
+	w = NewPIDWatcher(testProcFS(), store)
+	s.GPUs[1].Processes = s.GPUs[1].Processes[:len(s.GPUs[1].Processes)-1]
+	s.GPUs[0].Processes = nil
+	s.CollectedAt = start.Add(time.Minute)
+	alerts := w.Observe(s)
+	if len(alerts) != 1 || alerts[0].ChatID != 2 {
+		t.Fatalf("expected only 500000 to exit, since 412873 is still in /proc: %v", alerts)
+	}
+	for _, want := range []string{"tg://user?id=12", "<code>500000</code> python", "Runtime: <b>0s</b> (since it was watched)", "2.0 GiB</b> on GPU 1"} {
+		if !strings.Contains(alerts[0].Text, want) {
+			t.Errorf("notice does not contain %q:\n%s", want, alerts[0].Text)
+		}
+	}
+
+	// A process with the same PID but a different start is a new one.
+	w.mu.Lock()
+	w.watches[0].Started = started.Add(-time.Hour)
+	w.mu.Unlock()
+	alerts = w.Observe(s)
+	if len(alerts) != 1 || alerts[0].ReplyTo != 5 {
+		t.Fatalf("expected 412873 to exit, got %v", alerts)
+	}
+	for _, want := range []string{"(alice)", "13.8 GiB</b> on GPU 0"} {
+		if !strings.Contains(alerts[0].Text, want) {
+			t.Errorf("notice does not contain %q:\n%s", want, alerts[0].Text)
+		}
+	}
+	if watches := w.List(1); len(watches) != 0 {
+		t.Fatalf("requests left: %v", watches)
+	}
+}
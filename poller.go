@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Alert is a message the bot pushes to the chat on its own.
+type Alert struct {
+	Text string
+	// ChatID sends the alert to a single chat instead of every alert chat, replying to ReplyTo if set.
+	ChatID  int64
+	ReplyTo int64
+}
+
+// Observer is fed every snapshot taken by the poller and returns the alerts to send.
+type Observer interface {
+	Observe(s *Snapshot) []Alert
+}
+
+// poll collects a snapshot every interval and passes it to the observers until ctx is done.
+func poll(ctx context.Context, collector Collector, interval time.Duration, observers []Observer, send func(Alert)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		snapshot, err := collector.Collect(ctx)
+		if err != nil {
+			log.Println("failed to collect gpu state:", err.Error())
+		} else {
+			for _, observer := range observers {
+				for _, alert := range observer.Observe(snapshot) {
+					send(alert)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poller runs poll in the background with observers built from the settings.
+type Poller struct {
+	Collector Collector
+	// Observers builds the observers for the settings; polling stops when there are none.
+	Observers func(s *Settings) []Observer
+	Send      func(Alert)
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	// done is closed once the running poll has returned.
+	done chan struct{}
+}
+
+// Apply restarts polling with fresh observers. Observers keep state, such as the alerts that are firing,
+// so Apply should only be called when the settings they are built from change. The old observers are done
+// before the new ones are built, so that the two never run side by side.
+func (p *Poller) Apply(s *Settings) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		p.cancel()
+		<-p.done
+		p.cancel, p.done = nil, nil
+	}
+
+	observers := p.Observers(s)
+	if len(observers) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p.cancel, p.done = cancel, done
+	go func() {
+		defer close(done)
+		poll(ctx, p.Collector, s.AlertInterval, observers, p.Send)
+	}()
+}
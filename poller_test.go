@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingObserver holds its first Observe until release is closed.
+type blockingObserver struct {
+	once      sync.Once
+	observing chan struct{}
+	release   chan struct{}
+	returned  atomic.Bool
+}
+
+func (o *blockingObserver) Observe(*Snapshot) []Alert {
+	o.once.Do(func() {
+		close(o.observing)
+		<-o.release
+		o.returned.Store(true)
+	})
+	return nil
+}
+
+type snapshotCollector struct{ s *Snapshot }
+
+func (c snapshotCollector) Collect(context.Context) (*Snapshot, error) { return c.s, nil }
+
+func TestPollerApplyWaitsForOldObservers(t *testing.T) {
+	old := &blockingObserver{observing: make(chan struct{}), release: make(chan struct{})}
+	builds := 0
+	p := &Poller{
+		Collector: snapshotCollector{loadFixture(t, "555")},
+		Observers: func(*Settings) []Observer {
+			builds++
+			if builds == 1 {
+				return []Observer{old}
+			}
+			if !old.returned.Load() {
+				t.Error("new observers built while the old ones were running")
+			}
+			next := &blockingObserver{observing: make(chan struct{}), release: make(chan struct{})}
+			close(next.release)
+			return []Observer{next}
+		},
+		Send: func(Alert) {},
+	}
+	s := &Settings{AlertInterval: time.Hour}
+
+	p.Apply(s)
+	<-old.observing
+
+	applied := make(chan struct{})
+	go func() {
+		p.Apply(s)
+		close(applied)
+	}()
+	select {
+	case <-applied:
+		t.Fatal("Apply returned while the old observers were running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(old.release)
+	<-applied
+	p.Apply(&Settings{AlertInterval: time.Hour})
+}
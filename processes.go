@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// maxCmdlineLength keeps long argument lists from flooding the /processes reply.
+const maxCmdlineLength = 300
+
+var procFS = NewProcFS()
+
+// processes handles /processes and lists the compute processes of every GPU together with their owners.
+func processes(b *gotgbot.Bot, ctx *ext.Context) error {
+	snapshot, err := collectSnapshot(b, ctx)
+	if snapshot == nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = ctx.EffectiveMessage.Reply(b, withSnapshotAge(renderProcesses(snapshot, procFS, now), snapshot, now), &gotgbot.SendMessageOpts{
+		ParseMode: "html",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send processes: %w", err)
+	}
+
+	return nil
+}
+
+func renderProcesses(s *Snapshot, procs *ProcFS, now time.Time) string {
+	var blocks []string
+	for _, gpu := range s.GPUs {
+		blocks = append(blocks, renderGPUProcesses(gpu, procs, now))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+// renderGPUProcesses renders the processes of a single GPU under its label.
+func renderGPUProcesses(gpu GPU, procs *ProcFS, now time.Time) string {
+	lines := []string{fmt.Sprintf("<b>%s</b>", gpuLabel(gpu))}
+	if len(gpu.Processes) == 0 {
+		lines = append(lines, "no processes")
+	}
+
+	for _, process := range gpu.Processes {
+		lines = append(lines, renderProcess(process, procs, now))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderProcess(process Process, procs *ProcFS, now time.Time) string {
+	info, err := procs.Process(process.PID, process.Name)
+
+	switch {
+	case errors.Is(err, ErrProcessGone):
+		return fmt.Sprintf("<code>%d</code> %s · %s\nexited or in another PID namespace", process.PID, html.EscapeString(process.Name), process.UsedMemory)
+	case errors.Is(err, ErrForeignPID):
+		return fmt.Sprintf("<code>%d</code> %s · %s\nnot visible from the bot's PID namespace", process.PID, html.EscapeString(process.Name), process.UsedMemory)
+	case err != nil:
+		return fmt.Sprintf("<code>%d</code> %s · %s\n%s", process.PID, html.EscapeString(process.Name), process.UsedMemory, html.EscapeString(err.Error()))
+	}
+
+	// Telegram refuses invalid UTF-8, so the command line is cut between characters.
+	cmdline := info.Cmdline
+	if runes := []rune(cmdline); len(runes) > maxCmdlineLength {
+		cmdline = string(runes[:maxCmdlineLength]) + "…"
+	}
+
+	lines := []string{
+		fmt.Sprintf("<code>%d</code> <b>%s</b> · %s · up %s (since %s)", process.PID, html.EscapeString(info.User), process.UsedMemory,
+			formatDuration(now.Sub(info.Started)), info.Started.In(now.Location()).Format("Jan 2 15:04")),
+		fmt.Sprintf("<code>%s</code>", html.EscapeString(cmdline)),
+	}
+	if info.Container != "" {
+		lines = append(lines, "container: "+html.EscapeString(info.Container))
+	} else if info.Cgroup != "" {
+		lines = append(lines, "cgroup: "+html.EscapeString(info.Cgroup))
+	}
+
+	return strings.Join(lines, "\n")
+}
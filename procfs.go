@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrProcessGone is returned when a process reported by nvidia-smi has no /proc entry,
+	// either because it has exited or because it lives in a PID namespace the bot cannot see.
+	ErrProcessGone = errors.New("process is gone or not visible")
+	// ErrForeignPID is returned when the /proc entry for a PID belongs to a different process,
+	// which happens when the bot and the GPU process run in different PID namespaces.
+	ErrForeignPID = errors.New("pid belongs to a process in another pid namespace")
+)
+
+// userHz is the kernel's USER_HZ, the unit of the start time in /proc/<pid>/stat.
+// It is 100 on every Linux architecture the driver supports.
+const userHz = 100
+
+// ProcInfo is what /proc tells about a process.
+type ProcInfo struct {
+	PID     int
+	UID     int
+	User    string
+	Cmdline string
+	Started time.Time
+	// Cgroup is the cgroup path of the process.
+	Cgroup string
+	// Container describes the container the process runs in, e.g. "docker 3f2a1b4c5d6e", if any.
+	Container string
+}
+
+// ProcFS reads process information from a procfs mount.
+type ProcFS struct {
+	// Root is the procfs mount point, usually /proc.
+	Root string
+	// LookupUser resolves a uid to a user name.
+	LookupUser func(uid int) (string, error)
+}
+
+func NewProcFS() *ProcFS {
+	return &ProcFS{
+		Root: "/proc",
+		LookupUser: func(uid int) (string, error) {
+			u, err := user.LookupId(strconv.Itoa(uid))
+			if err != nil {
+				return "", err
+			}
+			return u.Username, nil
+		},
+	}
+}
+
+// Process reads /proc/<pid>. name is the process name reported by nvidia-smi;
+// it is used to detect PIDs that refer to a different process in the bot's PID namespace.
+func (p *ProcFS) Process(pid int, name string) (ProcInfo, error) {
+	dir := filepath.Join(p.Root, strconv.Itoa(pid))
+	info := ProcInfo{PID: pid}
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if errors.Is(err, os.ErrNotExist) {
+		return info, ErrProcessGone
+	}
+	if err != nil {
+		return info, fmt.Errorf("failed to read cmdline: %w", err)
+	}
+	args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+	info.Cmdline = strings.Join(args, " ")
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if errors.Is(err, os.ErrNotExist) {
+		return info, ErrProcessGone
+	}
+	if err != nil {
+		return info, fmt.Errorf("failed to read stat: %w", err)
+	}
+	comm, startTicks, err := parseProcStat(stat)
+	if err != nil {
+		return info, err
+	}
+
+	if !sameProcess(name, args[0], comm) {
+		return info, ErrForeignPID
+	}
+
+	bootTime, err := p.bootTime()
+	if err != nil {
+		return info, err
+	}
+	info.Started = bootTime.Add(time.Duration(startTicks) * time.Second / userHz)
+
+	info.UID, err = p.uid(dir)
+	if err != nil {
+		return info, err
+	}
+	info.User = strconv.Itoa(info.UID)
+	if name, err := p.LookupUser(info.UID); err == nil {
+		info.User = name
+	}
+
+	// The cgroup is a nice-to-have, so a process that cannot be inspected is still reported.
+	if cgroup, err := os.ReadFile(filepath.Join(dir, "cgroup")); err == nil {
+		info.Cgroup, info.Container = parseCgroup(cgroup)
+	}
+
+	return info, nil
+}
+
+// parseProcStat returns the command name and the start time in clock ticks since boot.
+func parseProcStat(stat []byte) (string, uint64, error) {
+	// The command name is in parentheses and may itself contain spaces and parentheses.
+	open := bytes.IndexByte(stat, '(')
+	closing := bytes.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return "", 0, errors.New("malformed stat")
+	}
+	comm := string(stat[open+1 : closing])
+
+	// Fields after the command name start at field 3 (state); starttime is field 22.
+	fields := strings.Fields(string(stat[closing+1:]))
+	if len(fields) < 20 {
+		return "", 0, errors.New("malformed stat: too few fields")
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed stat: %w", err)
+	}
+
+	return comm, start, nil
+}
+
+// sameProcess compares the name nvidia-smi reports with the process found in /proc.
+func sameProcess(name, argv0, comm string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return true
+	}
+	base := filepath.Base(strings.Fields(name)[0])
+
+	// comm is truncated to 15 characters by the kernel.
+	return base == filepath.Base(argv0) || strings.HasPrefix(base, comm) && comm != ""
+}
+
+func (p *ProcFS) bootTime() (time.Time, error) {
+	f, err := os.Open(filepath.Join(p.Root, "stat"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read boot time: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			btime, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("malformed btime: %w", err)
+			}
+			return time.Unix(btime, 0), nil
+		}
+	}
+
+	return time.Time{}, errors.New("no btime in stat")
+}
+
+func (p *ProcFS) uid(dir string) (int, error) {
+	status, err := os.ReadFile(filepath.Join(dir, "status"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrProcessGone
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read status: %w", err)
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		if value, ok := strings.CutPrefix(line, "Uid:"); ok {
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				break
+			}
+			return strconv.Atoi(fields[0])
+		}
+	}
+
+	return 0, errors.New("no uid in status")
+}
+
+var containerPatterns = []struct {
+	runtime string
+	pattern *regexp.Regexp
+}{
+	{"kubernetes", regexp.MustCompile(`kubepods.*[/-]([0-9a-f]{64})(?:\.scope)?$`)},
+	{"docker", regexp.MustCompile(`docker[/-]([0-9a-f]{64})(?:\.scope)?$`)},
+	{"containerd", regexp.MustCompile(`cri-containerd-([0-9a-f]{64})\.scope$`)},
+	{"podman", regexp.MustCompile(`libpod-([0-9a-f]{64})(?:\.scope)?$`)},
+}
+
+// parseCgroup returns the cgroup path of a process and the container it runs in, if any.
+// The unified (v2) hierarchy is preferred; with cgroup v1 the first hierarchy naming a container wins.
+func parseCgroup(data []byte) (string, string) {
+	var path string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" || path == "" {
+			path = parts[2]
+		}
+
+		for _, c := range containerPatterns {
+			if m := c.pattern.FindStringSubmatch(parts[2]); m != nil {
+				return parts[2], c.runtime + " " + m[1][:12]
+			}
+		}
+	}
+
+	return path, ""
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func testProcFS() *ProcFS {
+	users := map[int]string{1001: "alice", 1002: "bob", 1003: "carol", 33: "www-data"}
+
+	return &ProcFS{
+		Root: filepath.Join("testdata", "proc"),
+		LookupUser: func(uid int) (string, error) {
+			if name, ok := users[uid]; ok {
+				return name, nil
+			}
+			return "", errors.New("unknown user")
+		},
+	}
+}
+
+func TestProcFSProcess(t *testing.T) {
+	procs := testProcFS()
+
+	info, err := procs.Process(412873, "/home/alice/.venv/bin/python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User != "alice" || info.UID != 1001 {
+		t.Errorf("user = %q (%d), want alice (1001)", info.User, info.UID)
+	}
+	if info.Cmdline != "/home/alice/.venv/bin/python train.py --lr 3e-4" {
+		t.Errorf("Cmdline = %q", info.Cmdline)
+	}
+	if want := time.Unix(1721800000+7200, 0); !info.Started.Equal(want) {
+		t.Errorf("Started = %v, want %v", info.Started, want)
+	}
+	if info.Container != "docker 3f2a1b4c5d6e" {
+		t.Errorf("Container = %q, want docker 3f2a1b4c5d6e", info.Container)
+	}
+
+	info, err = procs.Process(413022, "python3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Container != "kubernetes 9c8b7a6f5e4d" {
+		t.Errorf("Container = %q, want kubernetes 9c8b7a6f5e4d", info.Container)
+	}
+
+	info, err = procs.Process(90412, "/usr/bin/python3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User != "4242" {
+		t.Errorf("User = %q, want the numeric uid for unknown users", info.User)
+	}
+	if info.Container != "" || info.Cgroup != "/user.slice/user-4242.slice/session-7.scope" {
+		t.Errorf("cgroup = %q, container = %q", info.Cgroup, info.Container)
+	}
+
+	if _, err := procs.Process(90211, "/opt/conda/bin/python"); !errors.Is(err, ErrProcessGone) {
+		t.Errorf("missing process: err = %v, want ErrProcessGone", err)
+	}
+	if _, err := procs.Process(90388, "/usr/bin/python3"); !errors.Is(err, ErrForeignPID) {
+		t.Errorf("reused pid: err = %v, want ErrForeignPID", err)
+	}
+}
+
+func TestParseProcStat(t *testing.T) {
+	comm, start, err := parseProcStat([]byte("42 (weird ) name) S 1 42 42 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 1 0 12345 0 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comm != "weird ) name" || start != 12345 {
+		t.Errorf("parseProcStat = %q, %d, want %q, 12345", comm, start, "weird ) name")
+	}
+
+	if _, _, err := parseProcStat([]byte("42 (short) S 1")); err == nil {
+		t.Error("expected an error for a truncated stat")
+	}
+}
+
+func TestRenderProcesses(t *testing.T) {
+	now := time.Unix(1721800000+86400, 0).UTC()
+	procs := testProcFS()
+
+	for _, driver := range fixtures {
+		t.Run(driver, func(t *testing.T) {
+			checkGolden(t, "processes-"+driver, []string{renderProcesses(loadFixture(t, driver), procs, now)})
+		})
+	}
+}
+
+func TestRenderProcessCutsLongCmdline(t *testing.T) {
+	// A copy of the fixture process whose command line is a long run of Cyrillic, two bytes per character.
+	procs := testProcFS()
+	procs.Root = t.TempDir()
+	for _, name := range []string{"stat", "412873/cgroup", "412873/stat", "412873/status"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "proc", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(procs.Root, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procs.Root, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmdline := "/home/alice/.venv/bin/python\x00train.py\x00--name\x00" + strings.Repeat("обучение", 100)
+	if err := os.WriteFile(filepath.Join(procs.Root, "412873", "cmdline"), []byte(cmdline), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	text := renderProcess(Process{PID: 412873, Name: "/home/alice/.venv/bin/python"}, procs, time.Unix(1721800000+86400, 0).UTC())
+	if !utf8.ValidString(text) {
+		t.Fatalf("render is not valid UTF-8:\n%q", text)
+	}
+	if !strings.Contains(text, "…</code>") {
+		t.Errorf("command line was not cut:\n%s", text)
+	}
+}
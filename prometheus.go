@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Exporter serves the GPU state in the Prometheus text exposition format.
+type Exporter struct {
+	Collector Collector
+	// Host is the value of the host label of every metric.
+	Host string
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := e.Collector.Collect(r.Context())
+	if err != nil {
+		log.Println("failed to collect gpu state for /metrics:", err.Error())
+		http.Error(w, "failed to collect gpu state", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write([]byte(renderMetrics(snapshot, e.Host))); err != nil {
+		log.Println("failed to write /metrics:", err.Error())
+	}
+}
+
+// serveMetrics serves /metrics on addr until the listener fails.
+func serveMetrics(addr string, exporter *Exporter) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+
+	log.Printf("serving metrics on %s\n", addr)
+	log.Println("metrics listener stopped:", http.ListenAndServe(addr, mux))
+}
+
+type metricLabel struct {
+	name, value string
+}
+
+type metricSample struct {
+	labels []metricLabel
+	value  float64
+}
+
+type metricFamily struct {
+	name, help, kind string
+	samples          []metricSample
+}
+
+// metricWriter groups samples into families, keeping the order in which families are first used.
+type metricWriter struct {
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+func (w *metricWriter) add(name, help string, labels []metricLabel, value float64) {
+	if w.byName == nil {
+		w.byName = make(map[string]*metricFamily)
+	}
+
+	family, ok := w.byName[name]
+	if !ok {
+		family = &metricFamily{name: name, help: help, kind: "gauge"}
+		w.families = append(w.families, family)
+		w.byName[name] = family
+	}
+	family.samples = append(family.samples, metricSample{labels: labels, value: value})
+}
+
+// reading adds a sample for r scaled by scale, skipping readings the GPU does not report.
+func (w *metricWriter) reading(name, help string, labels []metricLabel, r Reading, scale float64) {
+	if r.OK() {
+		w.add(name, help, labels, r.Value*scale)
+	}
+}
+
+// flag adds 1 for "Yes" and 0 for "No", skipping anything else such as N/A.
+func (w *metricWriter) flag(name, help string, labels []metricLabel, value string) {
+	switch value {
+	case "Yes":
+		w.add(name, help, labels, 1)
+	case "No":
+		w.add(name, help, labels, 0)
+	}
+}
+
+func (w *metricWriter) String() string {
+	var b strings.Builder
+	for _, family := range w.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind)
+		for _, sample := range family.samples {
+			b.WriteString(family.name)
+			if len(sample.labels) > 0 {
+				b.WriteByte('{')
+				for i, label := range sample.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", label.name, escapeLabelValue(label.value))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+// withLabels returns a copy of labels with more labels appended.
+func withLabels(labels []metricLabel, more ...metricLabel) []metricLabel {
+	return append(append([]metricLabel(nil), labels...), more...)
+}
+
+// renderMetrics renders a snapshot in the Prometheus text format. Every GPU metric is labeled
+// with the host and the GPU index, UUID and name.
+func renderMetrics(s *Snapshot, host string) string {
+	var w metricWriter
+
+	w.add("nvidia_gpu_snapshot_timestamp_seconds", "When the GPU state was collected.",
+		[]metricLabel{{"host", host}}, float64(s.CollectedAt.UnixMilli())/1000)
+
+	for _, gpu := range s.GPUs {
+		labels := []metricLabel{
+			{"host", host},
+			{"index", strconv.Itoa(gpu.Index)},
+			{"uuid", gpu.UUID},
+			{"name", gpu.Name},
+		}
+
+		w.add("nvidia_gpu_info", "GPU and driver information.", withLabels(labels,
+			metricLabel{"architecture", gpu.Architecture},
+			metricLabel{"driver_version", s.Log.DriverVersion},
+			metricLabel{"cuda_version", s.Log.CudaVersion},
+		), 1)
+
+		w.reading("nvidia_gpu_utilization_ratio", "GPU utilization.", labels, gpu.GPUUtil, 0.01)
+		w.reading("nvidia_gpu_memory_utilization_ratio", "Memory controller utilization.", labels, gpu.MemoryUtil, 0.01)
+		w.reading("nvidia_gpu_memory_total_bytes", "Total frame buffer memory.", labels, gpu.MemoryTotal, 1)
+		w.reading("nvidia_gpu_memory_used_bytes", "Used frame buffer memory.", labels, gpu.MemoryUsed, 1)
+		w.reading("nvidia_gpu_memory_free_bytes", "Free frame buffer memory.", labels, gpu.MemoryFree, 1)
+		w.reading("nvidia_gpu_temperature_celsius", "GPU temperature.", labels, gpu.Temperature, 1)
+		w.reading("nvidia_gpu_power_draw_watts", "Power draw.", labels, gpu.PowerDraw, 1)
+		w.reading("nvidia_gpu_power_limit_watts", "Current power limit.", labels, gpu.PowerLimit, 1)
+		w.reading("nvidia_gpu_fan_speed_ratio", "Fan speed.", labels, gpu.FanSpeed, 0.01)
+
+		clocks := []struct {
+			name         string
+			current, max Reading
+		}{
+			{"graphics", gpu.GraphicsClock, gpu.MaxGraphicsClock},
+			{"sm", gpu.SMClock, gpu.MaxSMClock},
+			{"memory", gpu.MemClock, gpu.MaxMemClock},
+		}
+		for _, clock := range clocks {
+			clockLabels := withLabels(labels, metricLabel{"clock", clock.name})
+			w.reading("nvidia_gpu_clock_hertz", "Current clock speed.", clockLabels, clock.current, 1e6)
+			w.reading("nvidia_gpu_clock_max_hertz", "Maximum clock speed.", clockLabels, clock.max, 1e6)
+		}
+
+		for _, counter := range []struct {
+			name   string
+			errors ECCErrors
+		}{
+			{"volatile", gpu.ECCVolatile},
+			{"aggregate", gpu.ECCAggregate},
+		} {
+			for _, e := range []struct {
+				memory, kind string
+				value        Reading
+			}{
+				{"sram", "correctable", counter.errors.SRAMCorrectable},
+				{"sram", "uncorrectable", counter.errors.SRAMUncorrectable},
+				{"dram", "correctable", counter.errors.DRAMCorrectable},
+				{"dram", "uncorrectable", counter.errors.DRAMUncorrectable},
+			} {
+				w.reading("nvidia_gpu_ecc_errors", "ECC errors since the driver was loaded (volatile) or over the GPU's lifetime (aggregate).",
+					withLabels(labels, metricLabel{"counter", counter.name}, metricLabel{"memory", e.memory}, metricLabel{"type", e.kind}), e.value, 1)
+			}
+		}
+
+		w.reading("nvidia_gpu_retired_pages", "Retired memory pages.", withLabels(labels, metricLabel{"cause", "single_bit"}), gpu.RetiredPagesSingleBit, 1)
+		w.reading("nvidia_gpu_retired_pages", "Retired memory pages.", withLabels(labels, metricLabel{"cause", "double_bit"}), gpu.RetiredPagesDoubleBit, 1)
+		w.flag("nvidia_gpu_retired_pages_pending", "Whether pages will be retired on the next reboot.", labels, gpu.RetiredPagesPending)
+		w.reading("nvidia_gpu_remapped_rows", "Remapped memory rows.", withLabels(labels, metricLabel{"type", "correctable"}), gpu.RemappedRowsCorrectable, 1)
+		w.reading("nvidia_gpu_remapped_rows", "Remapped memory rows.", withLabels(labels, metricLabel{"type", "uncorrectable"}), gpu.RemappedRowsUncorrectable, 1)
+		w.flag("nvidia_gpu_remapped_rows_pending", "Whether rows will be remapped on the next GPU reset.", labels, gpu.RemappedRowsPending)
+		w.flag("nvidia_gpu_remapped_rows_failure", "Whether a row remapping failed.", labels, gpu.RemappedRowsFailure)
+
+		for _, process := range gpu.Processes {
+			w.reading("nvidia_gpu_process_memory_bytes", "GPU memory used by a process.", withLabels(labels,
+				metricLabel{"pid", strconv.Itoa(process.PID)},
+				metricLabel{"process_name", process.Name},
+				metricLabel{"type", process.Type},
+			), process.UsedMemory, 1)
+		}
+	}
+
+	return w.String()
+}
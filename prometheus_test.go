@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderMetrics(t *testing.T) {
+	for _, driver := range fixtures {
+		t.Run(driver, func(t *testing.T) {
+			s := loadFixture(t, driver)
+			s.CollectedAt = time.Unix(1721900000, 0)
+			checkGolden(t, "metrics-"+driver, []string{renderMetrics(s, "gpu-node-1")})
+		})
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if got, want := escapeLabelValue("a \"b\"\\c\nd"), `a \"b\"\\c\nd`; got != want {
+		t.Errorf("escapeLabelValue() = %s, want %s", got, want)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	exporter := &Exporter{Collector: staticCollector{loadFixture(t, "555")}, Host: "node"}
+
+	rec := httptest.NewRecorder()
+	exporter.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := `nvidia_gpu_temperature_celsius{host="node",index="1",uuid="GPU-1d2c3b4a-5e6f-7a8b-9c0d-e1f2a3b4c5d6",name="NVIDIA RTX A4000"}`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body does not contain %s:\n%s", want, rec.Body)
+	}
+}
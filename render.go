@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// maxMessageLength is the longest text Telegram accepts in a single message.
+const maxMessageLength = 4096
+
+// snapshotAgeLength is reserved at the end of a message for the snapshot age.
+const snapshotAgeLength = 64
+
+// renderState renders a snapshot as the /state messages: a header followed by one message per GPU.
+func renderState(s *Snapshot) []string {
+	results := s.Log
+
+	var info []string = []string{
+		fmt.Sprintf("Timestamp: <b>%s</b>", results.Timestamp),
+		fmt.Sprintf("Driver Version: <b>%s</b>", results.DriverVersion),
+		fmt.Sprintf("CUDA Version: <b>%s</b>", results.CudaVersion),
+		fmt.Sprintf("Attached GPUs: <b>%s</b>", results.AttachedGpus),
+	}
+
+	messages := []string{strings.Join(info, "\n")}
+
+	for _, gpu := range s.GPUs {
+		messages = append(messages, renderGPU(gpu))
+	}
+
+	return messages
+}
+
+// renderSummary renders a snapshot as a monospace table with one row per GPU,
+// split into as many messages as needed to stay within maxMessageLength.
+func renderSummary(s *Snapshot) []string {
+	return renderSummaryLimit(s, maxMessageLength)
+}
+
+func renderSummaryLimit(s *Snapshot, limit int) []string {
+	header := fmt.Sprintf("Driver <b>%s</b> · CUDA <b>%s</b> · <b>%d</b> GPUs", s.Log.DriverVersion, s.Log.CudaVersion, len(s.GPUs))
+
+	rows := [][]string{{"#", "Name", "Util", "Memory", "Temp", "Power"}}
+	for _, gpu := range s.GPUs {
+		rows = append(rows, []string{
+			fmt.Sprint(gpu.Index),
+			shortGPUName(gpu.Name),
+			gpu.GPUUtil.String(),
+			fmt.Sprintf("%s/%s", formatGiB(gpu.MemoryUsed), formatGiB(gpu.MemoryTotal)),
+			gpu.Temperature.String(),
+			fmt.Sprintf("%s/%s", formatWatts(gpu.PowerDraw), formatWatts(gpu.PowerLimit)),
+		})
+	}
+	lines := formatTable(rows, map[int]bool{0: true, 2: true, 3: true, 4: true, 5: true})
+
+	tableHeader := "<pre>" + html.EscapeString(lines[0]) + "\n"
+	const tableFooter = "</pre>"
+
+	var messages []string
+	message, empty := header+"\n"+tableHeader, true
+	for _, line := range lines[1:] {
+		line = html.EscapeString(line) + "\n"
+		if !empty && len(message)+len(line)+len(tableFooter) > limit {
+			messages = append(messages, message+tableFooter)
+			message = tableHeader
+		}
+		message, empty = message+line, false
+	}
+
+	return append(messages, message+tableFooter)
+}
+
+// renderSummaryMessage renders the summary table as a single message of at most limit characters,
+// pointing to /state summary, which splits the table, when the GPUs do not fit.
+func renderSummaryMessage(s *Snapshot, limit int) string {
+	messages := renderSummaryLimit(s, limit-len(summaryTruncated))
+	if len(messages) > 1 {
+		return messages[0] + summaryTruncated
+	}
+
+	return messages[0]
+}
+
+const summaryTruncated = "\n…more GPUs in /state summary"
+
+// formatTable pads the cells of rows into aligned lines. Columns in rightAligned are padded on the left.
+func formatTable(rows [][]string, rightAligned map[int]bool) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			padding := strings.Repeat(" ", widths[i]-len([]rune(cell)))
+			if rightAligned[i] {
+				cells[i] = padding + cell
+			} else {
+				cells[i] = cell + padding
+			}
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+
+	return lines
+}
+
+// shortGPUName drops the vendor prefix and truncates long product names to fit a table column.
+func shortGPUName(name string) string {
+	name = strings.TrimPrefix(name, "NVIDIA ")
+	if runes := []rune(name); len(runes) > 20 {
+		name = string(runes[:19]) + "…"
+	}
+
+	return name
+}
+
+func formatGiB(r Reading) string {
+	if !r.OK() {
+		return r.String()
+	}
+
+	return fmt.Sprintf("%.1fG", r.Value/gib)
+}
+
+func formatWatts(r Reading) string {
+	if !r.OK() {
+		return r.String()
+	}
+
+	return fmt.Sprintf("%.0fW", r.Value)
+}
+
+// gpuLabel identifies a GPU in messages that are not about a single GPU.
+func gpuLabel(gpu GPU) string {
+	return fmt.Sprintf("GPU %d (%s, %s)", gpu.Index, gpu.Name, gpu.ID)
+}
+
+func renderGPU(gpu GPU) string {
+	var fullGpuInfo []string = []string{
+		fmt.Sprintf("GPU ID: <b>%s</b>", gpu.ID),
+		fmt.Sprintf("Product Name: <b>%s</b> (%s)", gpu.Name, gpu.Architecture),
+		fmt.Sprintf("Fan speed: <b>%s</b>", gpu.FanSpeed),
+		"",
+		fmt.Sprintf("Memory total: <b>%s</b>", gpu.MemoryTotal),
+		fmt.Sprintf("Memory reserved: <b>%s</b>", gpu.MemoryReserved),
+		fmt.Sprintf("Memory used: <b>%s</b>", gpu.MemoryUsed),
+		fmt.Sprintf("Memory free: <b>%s</b>", gpu.MemoryFree),
+		"",
+		fmt.Sprintf("GPU utilization: <b>%s</b>", gpu.GPUUtil),
+		fmt.Sprintf("Memory utilization: <b>%s</b>", gpu.MemoryUtil),
+		"",
+		fmt.Sprintf("GPU temperature: <b>%s</b>", gpu.Temperature),
+		fmt.Sprintf("GPU power draw: <b>%s</b> / <b>%s</b>", gpu.PowerDraw, gpu.PowerLimit),
+	}
+
+	if len(gpu.Errors) > 0 {
+		var fields []string
+		for _, e := range gpu.Errors {
+			fields = append(fields, e.Field)
+		}
+		fullGpuInfo = append(fullGpuInfo, "", fmt.Sprintf("Unparsed fields: <code>%s</code>", strings.Join(fields, ", ")))
+	}
+
+	return strings.Join(fullGpuInfo, "\n")
+}
+
+// formatDuration formats d with at most two units, e.g. "2d4h", "3h12m" or "45s".
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	seconds := int(d/time.Second) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
+
+// withSnapshotAge appends how old the snapshot is to the text of a message, cutting the text at the
+// last full line if the message would get too long.
+func withSnapshotAge(text string, s *Snapshot, now time.Time) string {
+	age := now.Sub(s.CollectedAt).Truncate(time.Second)
+
+	footer := "\n<i>Collected just now</i>"
+	if age >= time.Second {
+		footer = fmt.Sprintf("\n<i>Collected %s ago</i>", formatDuration(age))
+	}
+
+	return truncateMessage(text, maxMessageLength-len(footer)) + footer
+}
+
+// truncateMessage cuts text longer than limit at the last full line.
+func truncateMessage(text string, limit int) string {
+	const ellipsis = "\n…"
+	if len(text) <= limit {
+		return text
+	}
+
+	cut := strings.LastIndexByte(text[:limit-len(ellipsis)], '\n')
+	if cut < 0 {
+		cut = limit - len(ellipsis)
+	}
+
+	return text[:cut] + ellipsis
+}
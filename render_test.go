@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares rendered messages with testdata/golden/<name>.golden.
+// Messages are separated by a line of dashes; run `go test -update` to rewrite the files.
+func checkGolden(t *testing.T, name string, messages []string) {
+	t.Helper()
+
+	got := strings.Join(messages, "\n-----\n") + "\n"
+	path := filepath.Join("testdata", "golden", name+".golden")
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s mismatch (run go test -update to accept):\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func TestRenderState(t *testing.T) {
+	for _, driver := range fixtures {
+		t.Run(driver, func(t *testing.T) {
+			messages := renderState(loadFixture(t, driver))
+			checkGolden(t, "state-"+driver, messages)
+		})
+	}
+}
+
+func TestRenderSummary(t *testing.T) {
+	for _, driver := range fixtures {
+		t.Run(driver, func(t *testing.T) {
+			checkGolden(t, "summary-"+driver, renderSummary(loadFixture(t, driver)))
+		})
+	}
+}
+
+func TestRenderSummarySplitsLongTables(t *testing.T) {
+	s := loadFixture(t, "555")
+	for len(s.GPUs) < 200 {
+		gpu := s.GPUs[len(s.GPUs)%2]
+		gpu.Index = len(s.GPUs)
+		s.GPUs = append(s.GPUs, gpu)
+	}
+
+	messages := renderSummary(s)
+	if len(messages) < 2 {
+		t.Fatalf("expected the table to be split, got %d message", len(messages))
+	}
+
+	rows := 0
+	for i, message := range messages {
+		if len(message) > maxMessageLength {
+			t.Errorf("message %d is %d characters long", i, len(message))
+		}
+		if !strings.Contains(message, "<pre>") || !strings.Contains(message, "Name") || !strings.HasSuffix(message, "</pre>") {
+			t.Errorf("message %d is not a complete table:\n%s", i, message)
+		}
+		rows += strings.Count(message, "RTX A4000")
+	}
+	if rows != len(s.GPUs) {
+		t.Errorf("got %d rows, want %d", rows, len(s.GPUs))
+	}
+
+	// The message the buttons edit points to the view that shows every GPU.
+	if message := renderSummaryMessage(s, maxMessageLength); len(message) > maxMessageLength || !strings.HasSuffix(message, "…more GPUs in /state summary") {
+		t.Errorf("single message is %d characters long and ends with %q", len(message), message[len(message)-40:])
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	long := strings.Repeat("0123456789\n", 500)
+	got := truncateMessage(long, maxMessageLength)
+	if len(got) > maxMessageLength || !strings.HasSuffix(got, "9\n…") {
+		t.Errorf("truncateMessage() length %d, ends with %q", len(got), got[len(got)-10:])
+	}
+
+	if got := truncateMessage("short", maxMessageLength); got != "short" {
+		t.Errorf("truncateMessage(short) = %q", got)
+	}
+}
+
+func TestWithSnapshotAge(t *testing.T) {
+	s := &Snapshot{CollectedAt: time.Date(2024, 7, 24, 15, 34, 38, 0, time.UTC)}
+
+	if got := withSnapshotAge("text", s, s.CollectedAt.Add(500*time.Millisecond)); got != "text\n<i>Collected just now</i>" {
+		t.Errorf("withSnapshotAge() = %q", got)
+	}
+	if got := withSnapshotAge("text", s, s.CollectedAt.Add(4*time.Second)); got != "text\n<i>Collected 4s ago</i>" {
+		t.Errorf("withSnapshotAge() = %q", got)
+	}
+	if got := withSnapshotAge(strings.Repeat("line\n", 1000), s, s.CollectedAt); len(got) > maxMessageLength {
+		t.Errorf("withSnapshotAge() is %d bytes long", len(got))
+	}
+}
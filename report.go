@@ -0,0 +1,302 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	// idleUtilization is the GPU utilization in percent below which a GPU counts as idle in reports.
+	idleUtilization = 5
+	// defaultHotTemperature is the temperature reports count hours above when there is no temperature alert rule.
+	defaultHotTemperature = 90
+	// reportTopN is how many processes and users a report lists.
+	reportTopN = 5
+)
+
+// usage accounts the GPU-hours of processes; it is created in main once the settings are known.
+var usage *ProcessUsage
+
+// ReportSchedule sends a report covering Range whenever Schedule matches.
+type ReportSchedule struct {
+	Spec     string
+	Schedule *cronSchedule
+	Range    time.Duration
+	// RangeText is Range as written in the config, such as "7d".
+	RangeText string
+}
+
+// gpuReport sums up the history of one GPU.
+type gpuReport struct {
+	index      int
+	name       string
+	covered    time.Duration
+	util, mem  reportStat
+	idle, hot  time.Duration
+	energyWh   float64
+	hasReading bool
+}
+
+// reportStat is the average and the peak of a metric.
+type reportStat struct {
+	sum, peak float64
+	n         int
+}
+
+func (r *reportStat) add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	r.sum += v
+	r.peak = max(r.peak, v)
+	r.n++
+}
+
+func (r reportStat) format(format string) string {
+	if r.n == 0 {
+		return "-"
+	}
+	return fmt.Sprintf(format, r.sum/float64(r.n), r.peak)
+}
+
+func summarizeGPU(points []historyPoint, step time.Duration, hotTemperature float64) gpuReport {
+	var r gpuReport
+	for _, p := range points {
+		r.hasReading = true
+		r.covered += step
+		r.util.add(p.Values[HistoryUtilization])
+		r.mem.add(p.Values[HistoryMemory])
+		if util := p.Values[HistoryUtilization]; util < idleUtilization {
+			r.idle += step
+		}
+		if temp := p.Values[HistoryTemperature]; temp > hotTemperature {
+			r.hot += step
+		}
+		if power := p.Values[HistoryPower]; !math.IsNaN(power) {
+			r.energyWh += power * step.Hours()
+		}
+	}
+	return r
+}
+
+// renderReport renders the utilization, idle and hot time, energy and top users of every GPU over the
+// last span. s labels the GPUs; without it they are listed by UUID.
+func renderReport(h *History, u *ProcessUsage, s *Snapshot, span time.Duration, rangeText string, hotTemperature float64, now time.Time) string {
+	type reportGPU struct {
+		uuid  string
+		index int
+		name  string
+	}
+	var gpus []reportGPU
+	if s != nil {
+		for _, gpu := range s.GPUs {
+			gpus = append(gpus, reportGPU{gpu.UUID, gpu.Index, shortGPUName(gpu.Name)})
+		}
+	}
+	for _, uuid := range h.GPUs() {
+		if !slices.ContainsFunc(gpus, func(g reportGPU) bool { return g.uuid == uuid }) {
+			gpus = append(gpus, reportGPU{uuid, -1, uuid})
+		}
+	}
+
+	since := now.Add(-span)
+	lines := []string{
+		fmt.Sprintf("<b>GPU report for the last %s</b>", html.EscapeString(rangeText)),
+		fmt.Sprintf("<i>%s – %s</i>", since.Format("Jan 2 15:04"), now.Format("Jan 2 15:04")),
+	}
+
+	rows := [][]string{{"#", "Name", "Util avg/max", "Mem avg/max", "Idle", fmt.Sprintf(">%.0fC", hotTemperature), "kWh"}}
+	var totalWh float64
+	var partial []string
+	for _, gpu := range gpus {
+		points, step := h.Points(gpu.uuid, since, now)
+		r := summarizeGPU(points, step, hotTemperature)
+
+		index := "?"
+		if gpu.index >= 0 {
+			index = fmt.Sprint(gpu.index)
+		}
+		if !r.hasReading {
+			rows = append(rows, []string{index, gpu.name, "no readings"})
+			continue
+		}
+		totalWh += r.energyWh
+		if r.covered < span*9/10 {
+			partial = append(partial, fmt.Sprintf("%s: %s", index, formatDuration(r.covered)))
+		}
+
+		rows = append(rows, []string{
+			index,
+			gpu.name,
+			r.util.format("%.0f/%.0f%%"),
+			r.mem.format("%.1f/%.1fG"),
+			formatDuration(r.idle),
+			formatDuration(r.hot),
+			fmt.Sprintf("%.2f", r.energyWh/1000),
+		})
+	}
+	if len(gpus) == 0 {
+		lines = append(lines, "", "No readings yet.")
+		return strings.Join(lines, "\n")
+	}
+
+	after := []string{fmt.Sprintf("Energy: <b>%.2f kWh</b> on all GPUs", totalWh/1000)}
+	if len(partial) > 0 {
+		if len(partial) > reportTopN {
+			partial = append(partial[:reportTopN], fmt.Sprintf("%d more", len(partial)-reportTopN))
+		}
+		after = append(after, "<i>Readings cover only part of the range for GPU "+strings.Join(partial, ", ")+"</i>")
+	}
+
+	totals := u.Totals(since)
+	after = append(after, "", "<b>Top processes</b> by GPU-hours")
+	after = append(after, renderTopUsage(totals, func(k usageKey) string { return fmt.Sprintf("%s (%s)", k.Process, k.User) })...)
+	after = append(after, "", "<b>Top users</b> by GPU-hours")
+	after = append(after, renderTopUsage(totals, func(k usageKey) string { return k.User })...)
+
+	// The table is cut to fit before it is wrapped, since cutting the message inside <pre> would leave it open.
+	const pre, preEnd = "<pre>", "</pre>"
+	budget := maxMessageLength - len(strings.Join(lines, "\n")) - len(strings.Join(after, "\n")) - len(pre+preEnd) - 2
+	table := fitTable(formatTable(rows, map[int]bool{0: true, 2: true, 3: true, 4: true, 5: true, 6: true}), budget)
+	lines = append(lines, pre+table+preEnd)
+	lines = append(lines, after...)
+
+	return truncateMessage(strings.Join(lines, "\n"), maxMessageLength)
+}
+
+// fitTable escapes and joins the lines of a table, dropping the last rows with a note when they
+// do not fit in limit characters. The header row is always kept.
+func fitTable(table []string, limit int) string {
+	text := html.EscapeString(table[0])
+	for i, line := range table[1:] {
+		line = "\n" + html.EscapeString(line)
+		more := ""
+		if rest := len(table) - 2 - i; rest > 0 {
+			more = fmt.Sprintf("\n… %d more GPUs", rest)
+		}
+		if len(text)+len(line)+len(more) > limit {
+			return text + fmt.Sprintf("\n… %d more GPUs", len(table)-1-i)
+		}
+		text += line
+	}
+	return text
+}
+
+// renderTopUsage sums the GPU-hours by the name of each key and lists the largest sums.
+func renderTopUsage(totals map[usageKey]float64, name func(usageKey) string) []string {
+	sums := make(map[string]float64)
+	for key, hours := range totals {
+		sums[name(key)] += hours
+	}
+	if len(sums) == 0 {
+		return []string{"no processes"}
+	}
+
+	names := make([]string, 0, len(sums))
+	for n := range sums {
+		names = append(names, n)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(sums[b], sums[a]), strings.Compare(a, b))
+	})
+
+	var lines []string
+	for _, n := range names[:min(len(names), reportTopN)] {
+		lines = append(lines, fmt.Sprintf("%.1f h  %s", sums[n], html.EscapeString(n)))
+	}
+	return lines
+}
+
+// hotTemperature is the threshold of the temperature alert rule, which reports count the hours above.
+func hotTemperature(rules []AlertRule) float64 {
+	for _, rule := range rules {
+		if rule.Metric == MetricTemperature {
+			return rule.Threshold
+		}
+	}
+	return defaultHotTemperature
+}
+
+// buildReport collects a snapshot to label the GPUs and renders the report over the last span.
+func buildReport(ctx context.Context, span time.Duration, rangeText string) string {
+	s, err := collector.Collect(ctx)
+	if err != nil {
+		log.Println("failed to collect gpu state for a report:", err.Error())
+	}
+
+	return renderReport(history, usage, s, span, rangeText, hotTemperature(settings.Load().AlertRules), time.Now())
+}
+
+// report handles /report [range] and replies with the report over the range, by default 24h.
+func report(b *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()[1:]
+	rangeText := "24h"
+	if len(args) > 0 {
+		rangeText = args[0]
+	}
+	span, err := parseHistoryRange(rangeText)
+	if err != nil || len(args) > 1 {
+		return replyHTML(b, ctx, "Usage: /report [range], e.g. /report 24h or /report 7d")
+	}
+
+	return replyHTML(b, ctx, buildReport(context.Background(), span, rangeText))
+}
+
+// Reporter sends the reports of the schedules in the background.
+type Reporter struct {
+	Send func(Alert)
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// Apply replaces the schedules.
+func (r *Reporter) Apply(schedules []ReportSchedule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+	if len(schedules) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	for _, schedule := range schedules {
+		go r.run(ctx, schedule)
+	}
+}
+
+func (r *Reporter) run(ctx context.Context, schedule ReportSchedule) {
+	for {
+		next, err := schedule.Schedule.Next(time.Now())
+		if err != nil {
+			log.Printf("report schedule %q: %s\n", schedule.Spec, err)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		r.Send(Alert{Text: buildReport(ctx, schedule.Range, schedule.RangeText)})
+	}
+}
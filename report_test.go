@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderReport(t *testing.T) {
+	start := time.Date(2024, 7, 24, 0, 0, 0, 0, time.UTC)
+	h := NewHistory(defaultHistoryTiers, time.Minute)
+	u := NewProcessUsage(time.Minute, 7*24*time.Hour, testProcFS())
+
+	// Twelve hours at 300 W and full utilization, then twelve idle hours at 50 W.
+	base := loadFixture(t, "555")
+	var now time.Time
+	for i := 0; i <= 24*60; i++ {
+		now = start.Add(time.Duration(i) * time.Minute)
+		s := &Snapshot{Log: base.Log, GPUs: slices.Clone(base.GPUs), CollectedAt: now}
+		for j := range s.GPUs {
+			gpu := &s.GPUs[j]
+			gpu.GPUUtil, gpu.PowerDraw, gpu.Temperature = Reading{Value: 100}, Reading{Value: 300}, Reading{Value: 95}
+			if i >= 12*60 {
+				gpu.GPUUtil, gpu.PowerDraw, gpu.Temperature = Reading{Value: 0}, Reading{Value: 50}, Reading{Value: 40}
+				gpu.Processes = nil
+			}
+		}
+		h.Observe(s)
+		u.Observe(s)
+	}
+
+	s := loadFixture(t, "555")
+	text := renderReport(h, u, s, 24*time.Hour, "24h", 90, now)
+
+	for _, want := range []string{
+		"GPU report for the last 24h",
+		"50/100%",
+		"&gt;90C",
+		"12h0m",
+		"4.20",
+		"Energy: <b>8.40 kWh</b> on all GPUs",
+		"Top processes",
+		"Top users",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report does not contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Readings cover only part") {
+		t.Errorf("report covering the whole range is marked partial:\n%s", text)
+	}
+
+	// 555 runs a process of alice and one of bob, for twelve hours.
+	for _, want := range []string{"12.0 h  alice", "12.0 h  bob"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report does not contain %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestRenderReportFitsManyGPUs(t *testing.T) {
+	start := time.Date(2024, 7, 24, 0, 0, 0, 0, time.UTC)
+	h := NewHistory(defaultHistoryTiers, time.Minute)
+	u := NewProcessUsage(time.Minute, 7*24*time.Hour, testProcFS())
+
+	s := loadFixture(t, "555")
+	for len(s.GPUs) < 200 {
+		gpu := s.GPUs[len(s.GPUs)%2]
+		gpu.Index, gpu.UUID = len(s.GPUs), fmt.Sprintf("GPU-%d", len(s.GPUs))
+		s.GPUs = append(s.GPUs, gpu)
+	}
+	for i := 0; i <= 60; i++ {
+		s.CollectedAt = start.Add(time.Duration(i) * time.Minute)
+		h.Observe(s)
+		u.Observe(s)
+	}
+
+	text := renderReport(h, u, s, 24*time.Hour, "24h", 90, s.CollectedAt)
+	if len(text) > maxMessageLength {
+		t.Errorf("report is %d characters long", len(text))
+	}
+	if strings.Count(text, "<pre>") != 1 || strings.Count(text, "</pre>") != 1 {
+		t.Fatalf("report table is not closed:\n%s", text)
+	}
+	for _, want := range []string{"more GPUs</pre>", "Energy:", "Readings cover only part of the range for GPU 0: 1h1m, 1: 1h1m", "195 more</i>", "Top users"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report does not contain %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestHotTemperature(t *testing.T) {
+	if got := hotTemperature([]AlertRule{{Metric: MetricPower, Threshold: 98}, {Metric: MetricTemperature, Threshold: 85}}); got != 85 {
+		t.Errorf("hotTemperature() = %v, want 85", got)
+	}
+	if got := hotTemperature(nil); got != defaultHotTemperature {
+		t.Errorf("hotTemperature(nil) = %v", got)
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// storeFile is the database in the state directory.
+const storeFile = "gpu-state.db"
+
+var (
+	// metricsBucket holds a bucket per GPU UUID with a bucket per history tier, keyed by time.
+	metricsBucket = []byte("metrics")
+	// stateBucket holds JSON documents such as subscriptions and the alerts that are firing.
+	stateBucket = []byte("state")
+	// usageBucket holds the GPU-hours of processes as JSON, keyed by the start of the hour.
+	usageBucket = []byte("usage")
+)
+
+// errCorruptDB marks a database file that was opened but cannot be used.
+var errCorruptDB = errors.New("database is corrupt")
+
+// Store keeps the metric history, alert state and subscriptions in a database in the state directory.
+// A nil Store keeps nothing, which is how the bot runs when the database cannot be opened.
+type Store struct {
+	db *bbolt.DB
+}
+
+// OpenStore opens the database in dir and compacts it when it is mostly free space. A database file that
+// cannot be read or fails its consistency check is moved aside and replaced by an empty one; other errors,
+// such as a missing or unwritable dir, are returned as they are.
+func OpenStore(dir string) (*Store, error) {
+	path := filepath.Join(dir, storeFile)
+
+	db, err := openDB(path)
+	if errors.Is(err, errCorruptDB) {
+		broken := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+		log.Printf("database %s is unusable (%s), moving it to %s and starting empty\n", path, err, broken)
+		if err := os.Rename(path, broken); err != nil {
+			return nil, fmt.Errorf("failed to move the database aside: %w", err)
+		}
+		db, err = openDB(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the database: %w", err)
+	}
+
+	db, err = compactDB(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compact the database: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func openDB(path string) (db *bbolt.DB, err error) {
+	// bbolt panics on some kinds of corruption instead of returning an error.
+	defer func() {
+		if r := recover(); r != nil {
+			if db != nil {
+				db.Close()
+			}
+			db, err = nil, fmt.Errorf("%w: %v", errCorruptDB, r)
+		}
+	}()
+
+	db, err = bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if errors.Is(err, bbolt.ErrInvalid) || errors.Is(err, bbolt.ErrVersionMismatch) || errors.Is(err, bbolt.ErrChecksum) {
+		return nil, fmt.Errorf("%w: %w", errCorruptDB, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Every page is read here rather than with tx.Check, which checks in a goroutine of its own where the
+	// panics of a corrupt page cannot be recovered.
+	err = db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			return walkBucket(name, b)
+		})
+	})
+	if err == nil {
+		err = db.Update(func(tx *bbolt.Tx) error {
+			for _, name := range [][]byte{metricsBucket, stateBucket, usageBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// walkBucket reads every key of a bucket and its nested buckets.
+func walkBucket(name []byte, b *bbolt.Bucket) error {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			continue
+		}
+		nested := b.Bucket(k)
+		if nested == nil {
+			return fmt.Errorf("%w: bucket %q has a broken entry %q", errCorruptDB, name, k)
+		}
+		if err := walkBucket(k, nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactDB rewrites the database when more than half of it is free pages left behind by pruning,
+// since bbolt reuses free pages but never shrinks the file. It keeps the database as it is when
+// the copy fails.
+func compactDB(db *bbolt.DB) (*bbolt.DB, error) {
+	path := db.Path()
+	info, err := os.Stat(path)
+	if err != nil || int64(db.Stats().FreeAlloc)*2 < info.Size() {
+		return db, nil
+	}
+
+	tmp := path + ".compact"
+	defer os.Remove(tmp)
+	if err := copyDB(db, tmp); err != nil {
+		log.Println("failed to compact the database:", err.Error())
+		return db, nil
+	}
+
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	log.Printf("compacted the database from %d bytes\n", info.Size())
+
+	return openDB(path)
+}
+
+func copyDB(src *bbolt.DB, path string) error {
+	dst, err := bbolt.Open(path, 0o600, nil)
+	if err != nil {
+		return err
+	}
+	if err := bbolt.Compact(dst, src, 1<<20); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// storedPoint is a history point of one GPU and tier.
+type storedPoint struct {
+	GPU   string
+	Tier  string
+	Point historyPoint
+}
+
+func timeKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+func encodeValues(values historyValues) []byte {
+	data := make([]byte, 0, 8*len(values))
+	for _, value := range values {
+		data = binary.BigEndian.AppendUint64(data, math.Float64bits(value))
+	}
+	return data
+}
+
+func decodeValues(data []byte) historyValues {
+	var values historyValues
+	for i := range values {
+		values[i] = math.NaN()
+		// Points written before a metric was added are shorter.
+		if len(data) >= 8*(i+1) {
+			values[i] = math.Float64frombits(binary.BigEndian.Uint64(data[8*i:]))
+		}
+	}
+	return values
+}
+
+// AddPoints saves history points in a single transaction.
+func (s *Store) AddPoints(points []storedPoint) error {
+	if s == nil || len(points) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		metrics := tx.Bucket(metricsBucket)
+		for _, p := range points {
+			gpu, err := metrics.CreateBucketIfNotExists([]byte(p.GPU))
+			if err != nil {
+				return err
+			}
+			tier, err := gpu.CreateBucketIfNotExists([]byte(p.Tier))
+			if err != nil {
+				return err
+			}
+			if err := tier.Put(timeKey(p.Point.Time), encodeValues(p.Point.Values)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EachPoint calls fn with every saved point of every GPU in tier since the given time, oldest first.
+func (s *Store) EachPoint(tier string, since time.Time, fn func(gpu string, p historyPoint)) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metricsBucket).ForEachBucket(func(gpu []byte) error {
+			b := tx.Bucket(metricsBucket).Bucket(gpu).Bucket([]byte(tier))
+			if b == nil {
+				return nil
+			}
+
+			c := b.Cursor()
+			for k, v := c.Seek(timeKey(since)); k != nil; k, v = c.Next() {
+				at := time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+				fn(string(gpu), historyPoint{Time: at, Values: decodeValues(v)})
+			}
+			return nil
+		})
+	})
+}
+
+// Prune deletes the points older than each tier keeps them, the tiers that are no longer
+// configured and GPUs without points. It returns the number of deleted points.
+func (s *Store) Prune(tiers []HistoryTier, now time.Time) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	keep := make(map[string]time.Duration)
+	for _, tier := range tiers {
+		keep[tier.Name()] = tier.Keep
+	}
+
+	var deleted int
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		metrics := tx.Bucket(metricsBucket)
+
+		var emptyGPUs [][]byte
+		err := metrics.ForEachBucket(func(name []byte) error {
+			gpu := metrics.Bucket(name)
+
+			var unknown [][]byte
+			err := gpu.ForEachBucket(func(tierName []byte) error {
+				d, ok := keep[string(tierName)]
+				if !ok {
+					unknown = append(unknown, bytes.Clone(tierName))
+					return nil
+				}
+
+				// Deleting while iterating with a cursor skips keys, so the old keys are collected first.
+				tier := gpu.Bucket(tierName)
+				before := timeKey(now.Add(-d))
+				var old [][]byte
+				c := tier.Cursor()
+				for k, _ := c.First(); k != nil && bytes.Compare(k, before) < 0; k, _ = c.Next() {
+					old = append(old, k)
+				}
+				for _, k := range old {
+					if err := tier.Delete(k); err != nil {
+						return err
+					}
+				}
+				deleted += len(old)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, tierName := range unknown {
+				deleted += gpu.Bucket(tierName).Stats().KeyN
+				if err := gpu.DeleteBucket(tierName); err != nil {
+					return err
+				}
+			}
+
+			empty := true
+			err = gpu.ForEachBucket(func(tierName []byte) error {
+				empty = empty && gpu.Bucket(tierName).Stats().KeyN == 0
+				return nil
+			})
+			if empty {
+				emptyGPUs = append(emptyGPUs, bytes.Clone(name))
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range emptyGPUs {
+			if err := metrics.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return deleted, err
+}
+
+// Load decodes the JSON document saved under key into v and reports whether there was one.
+func (s *Store) Load(key string, v any) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	var data []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if value := tx.Bucket(stateBucket).Get([]byte(key)); value != nil {
+			data = bytes.Clone(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if data == nil {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Save saves v as a JSON document under key.
+func (s *Store) Save(key string, v any) error {
+	if s == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(stateBucket).Put([]byte(key), data)
+	})
+}
+
+// SaveUsage replaces the GPU-hours of the hour starting at hour.
+func (s *Store) SaveUsage(hour time.Time, entries []usageEntry) error {
+	if s == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(usageBucket).Put(timeKey(hour), data)
+	})
+}
+
+// EachUsage calls fn with the GPU-hours of every saved hour starting at or after since.
+func (s *Store) EachUsage(since time.Time, fn func(hour time.Time, entries []usageEntry)) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(usageBucket).Cursor()
+		for k, v := c.Seek(timeKey(since)); k != nil; k, v = c.Next() {
+			var entries []usageEntry
+			if err := json.Unmarshal(v, &entries); err != nil {
+				return fmt.Errorf("failed to parse gpu usage: %w", err)
+			}
+			fn(time.Unix(0, int64(binary.BigEndian.Uint64(k))), entries)
+		}
+		return nil
+	})
+}
+
+// PruneUsage deletes the GPU-hours of the hours starting before before.
+func (s *Store) PruneUsage(before time.Time) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(usageBucket)
+		var old [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, timeKey(before)) < 0; k, _ = c.Next() {
+			old = append(old, k)
+		}
+		for _, k := range old {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStoreState(t *testing.T) {
+	dir := t.TempDir()
+	// Files that merely share a name with a key are left alone.
+	if err := os.WriteFile(filepath.Join(dir, "live.json"), []byte(`[{"chat_id": 1}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var sessions []liveSession
+	if ok, err := store.Load("live", &sessions); ok || err != nil {
+		t.Fatalf("Load(live) = %v, %v, %+v", ok, err, sessions)
+	}
+	if err := store.Save("live", []liveSession{{ChatID: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "live.json")); err != nil {
+		t.Errorf("live.json was removed: %v", err)
+	}
+	if ok, _ := store.Load("live", &sessions); !ok || sessions[0].ChatID != 2 {
+		t.Errorf("Load(live) after Save = %+v", sessions)
+	}
+
+	var missing []string
+	if ok, err := store.Load("missing", &missing); ok || err != nil {
+		t.Errorf("Load(missing) = %v, %v", ok, err)
+	}
+
+	var nilStore *Store
+	if ok, err := nilStore.Load("live", &sessions); ok || err != nil || nilStore.Save("live", sessions) != nil {
+		t.Errorf("nil store Load = %v, %v", ok, err)
+	}
+}
+
+func TestStoreCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, storeFile), []byte("definitely not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatalf("OpenStore() with a corrupt file = %v", err)
+	}
+	defer store.Close()
+
+	if broken, _ := filepath.Glob(filepath.Join(dir, storeFile+".corrupt-*")); len(broken) != 1 {
+		t.Errorf("corrupt file was not moved aside: %v", broken)
+	}
+	if err := store.Save("live", []liveSession{}); err != nil {
+		t.Errorf("Save() on the new database = %v", err)
+	}
+}
+
+func TestStoreCorruptPages(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHistory([]HistoryTier{{Keep: time.Hour}}, time.Second)
+	if err := h.Restore(store, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s := loadFixture(t, "555")
+	for i := 0; i < 100; i++ {
+		s.CollectedAt = time.Now().Add(time.Duration(i) * time.Second)
+		h.Observe(s)
+	}
+	store.Close()
+
+	// The meta pages and the freelist stay valid, so the database opens; every other page is overwritten.
+	path := filepath.Join(dir, storeFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageSize := int(binary.LittleEndian.Uint32(data[24:]))
+	meta := data[:pageSize]
+	if second := data[pageSize : 2*pageSize]; binary.LittleEndian.Uint64(second[64:]) > binary.LittleEndian.Uint64(meta[64:]) {
+		meta = second
+	}
+	freelist := int(binary.LittleEndian.Uint64(meta[48:]))
+	for page := 2; page < len(data)/pageSize; page++ {
+		if page == freelist {
+			continue
+		}
+		for i := page * pageSize; i < (page+1)*pageSize; i++ {
+			data[i] = 0xff
+		}
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatalf("OpenStore() with corrupt pages = %v", err)
+	}
+	defer store.Close()
+
+	if broken, _ := filepath.Glob(filepath.Join(dir, storeFile+".corrupt-*")); len(broken) != 1 {
+		t.Errorf("corrupt file was not moved aside: %v", broken)
+	}
+	var sessions []liveSession
+	if ok, err := store.Load("live", &sessions); ok || err != nil {
+		t.Errorf("Load() on the new database = %v, %v", ok, err)
+	}
+}
+
+func TestStoreMissingDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+
+	_, err := OpenStore(dir)
+	if !errors.Is(err, os.ErrNotExist) || errors.Is(err, errCorruptDB) {
+		t.Fatalf("OpenStore() in a missing directory = %v", err)
+	}
+}
+
+func TestHistorySurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	tiers := []HistoryTier{{Keep: 10 * time.Minute}, {Step: time.Minute, Keep: time.Hour}}
+	start := time.Date(2024, 7, 24, 12, 0, 0, 0, time.UTC)
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHistory(tiers, 10*time.Second)
+	if err := h.Restore(store, start); err != nil {
+		t.Fatal(err)
+	}
+	var now time.Time
+	for i := 0; i < 360; i++ {
+		now = start.Add(time.Duration(i) * 10 * time.Second)
+		h.Observe(historySnapshot(t, now, float64(i%2*100)))
+	}
+	uuid := loadFixture(t, "535").GPUs[0].UUID
+	before, _ := h.Query(uuid, HistoryUtilization, now.Add(-30*time.Minute), now)
+	store.Close()
+
+	store, err = OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	restored := NewHistory(tiers, 10*time.Second)
+	if err := restored.Restore(store, now); err != nil {
+		t.Fatal(err)
+	}
+
+	after, _ := restored.Query(uuid, HistoryUtilization, now.Add(-30*time.Minute), now)
+	// The bucket being averaged when the bot stopped is lost.
+	if !slices.EqualFunc(after, before[:len(before)-1], func(a, b chartPoint) bool { return a.Time.Equal(b.Time) && a.Value == b.Value }) {
+		t.Errorf("restored history = %v, want %v", after, before[:len(before)-1])
+	}
+	raw, _ := restored.Query(uuid, HistoryUtilization, now.Add(-5*time.Minute), now)
+	if len(raw) != 31 {
+		t.Errorf("restored raw samples = %d, want 31", len(raw))
+	}
+
+	// Points older than their tier keeps them are pruned, and so are tiers that are no longer used.
+	deleted, err := store.Prune(tiers[:1], now)
+	if err != nil || deleted == 0 {
+		t.Fatalf("Prune() = %d, %v", deleted, err)
+	}
+	pruned := NewHistory(tiers, 10*time.Second)
+	if err := pruned.Restore(store, now); err != nil {
+		t.Fatal(err)
+	}
+	if averaged, step := pruned.Query(uuid, HistoryUtilization, now.Add(-30*time.Minute), now); len(averaged) != 0 {
+		t.Errorf("pruned tier still has %d points every %s", len(averaged), step)
+	}
+}
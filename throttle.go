@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultThrottleDuration is how long a busy GPU may be thermally or power throttled before an alert.
+	defaultThrottleDuration = 10 * time.Minute
+	// throttleStateKey is where the store keeps since when GPUs are throttled.
+	throttleStateKey = "throttled_gpus"
+)
+
+// clockEventReasons explains the clock event reasons in the order nvidia-smi lists them.
+var clockEventReasons = []struct {
+	name        string
+	description string
+	// kind is "thermal" or "power" for the reasons that throttle a busy GPU.
+	kind string
+}{
+	{"gpu_idle", "idle: nothing runs, so the clocks are down", ""},
+	{"applications_clocks_setting", "capped by the application clocks setting", ""},
+	{"sw_power_cap", "power capped: the driver keeps the power draw at the power limit", "power"},
+	{"hw_slowdown", "hardware slowdown: the GPU is too hot or the power supply asks it to slow down", "thermal"},
+	{"hw_thermal_slowdown", "hardware thermal slowdown: the GPU is too hot", "thermal"},
+	{"hw_power_brake_slowdown", "hardware power brake: the power supply or system asks the GPU to slow down", "power"},
+	{"sync_boost", "held back to the clocks of the other GPUs in its sync boost group", ""},
+	{"sw_thermal_slowdown", "thermal slowdown: the driver keeps the GPU or its memory below the target temperature", "thermal"},
+	{"display_clocks_setting", "capped by the display clock setting", ""},
+}
+
+// describeClockEventReason explains a reason, or returns its name when it is unknown.
+func describeClockEventReason(name string) string {
+	for _, reason := range clockEventReasons {
+		if reason.name == name {
+			return reason.description
+		}
+	}
+	return name
+}
+
+// throttleKinds returns whether the GPU is thermally and power throttled. ignorePowerCap leaves out the
+// software power cap, which a busy GPU at its power limit reports most of the time.
+func throttleKinds(gpu GPU, ignorePowerCap bool) (thermal, power bool) {
+	for _, name := range gpu.ClockEventReasons {
+		for _, reason := range clockEventReasons {
+			if reason.name != name || ignorePowerCap && name == "sw_power_cap" {
+				continue
+			}
+			thermal = thermal || reason.kind == "thermal"
+			power = power || reason.kind == "power"
+		}
+	}
+	return thermal, power
+}
+
+// throttledGPU is a busy GPU that is thermally or power throttled.
+type throttledGPU struct {
+	Since    time.Time `json:"since"`
+	Notified bool      `json:"notified"`
+}
+
+// ThrottleDetector alerts when a busy GPU is thermally or power throttled for longer than Duration,
+// and again once the throttling stops.
+type ThrottleDetector struct {
+	Duration time.Duration
+	// IgnorePowerCap does not count the software power cap as throttling.
+	IgnorePowerCap bool
+
+	store     *Store
+	throttled map[string]*throttledGPU
+}
+
+// NewThrottleDetector creates a detector that continues with the throttled GPUs saved in the store.
+func NewThrottleDetector(duration time.Duration, ignorePowerCap bool, store *Store) *ThrottleDetector {
+	d := &ThrottleDetector{Duration: duration, IgnorePowerCap: ignorePowerCap, store: store, throttled: make(map[string]*throttledGPU)}
+	if _, err := store.Load(throttleStateKey, &d.throttled); err != nil {
+		log.Println("failed to load throttled gpus:", err.Error())
+	}
+
+	return d
+}
+
+func (d *ThrottleDetector) Observe(s *Snapshot) []Alert {
+	var alerts []Alert
+	changed := false
+
+	seen := make(map[string]bool)
+	for _, gpu := range s.GPUs {
+		seen[gpu.UUID] = true
+		state, wasThrottled := d.throttled[gpu.UUID]
+
+		thermal, power := throttleKinds(gpu, d.IgnorePowerCap)
+		busy := gpu.GPUUtil.OK() && gpu.GPUUtil.Value >= idleUtilization
+		if !busy || !thermal && !power {
+			if wasThrottled {
+				if state.Notified {
+					alerts = append(alerts, Alert{Text: fmt.Sprintf("<b>RESOLVED</b> %s: no longer throttled after %s",
+						gpuLabel(gpu), formatDuration(s.CollectedAt.Sub(state.Since)))})
+				}
+				delete(d.throttled, gpu.UUID)
+				changed = true
+			}
+			continue
+		}
+		if !wasThrottled {
+			state = &throttledGPU{Since: s.CollectedAt}
+			d.throttled[gpu.UUID] = state
+			changed = true
+		}
+
+		if !state.Notified && s.CollectedAt.Sub(state.Since) >= d.Duration {
+			state.Notified = true
+			changed = true
+			alerts = append(alerts, Alert{Text: renderThrottleAlert(gpu, thermal, power, s.CollectedAt.Sub(state.Since))})
+		}
+	}
+	for uuid := range d.throttled {
+		if !seen[uuid] {
+			delete(d.throttled, uuid)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := d.store.Save(throttleStateKey, d.throttled); err != nil {
+			log.Println("failed to save throttled gpus:", err.Error())
+		}
+	}
+
+	return alerts
+}
+
+func renderThrottleAlert(gpu GPU, thermal, power bool, throttledFor time.Duration) string {
+	kind := "power"
+	switch {
+	case thermal && power:
+		kind = "thermally and power"
+	case thermal:
+		kind = "thermally"
+	}
+
+	lines := []string{
+		fmt.Sprintf("<b>ALERT</b> %s: <b>%s throttled</b> for %s at %s utilization", gpuLabel(gpu), kind, formatDuration(throttledFor), gpu.GPUUtil),
+		fmt.Sprintf("SM clock %s of %s, temperature %s, power %s of %s", gpu.SMClock, gpu.MaxSMClock, gpu.Temperature, gpu.PowerDraw, gpu.PowerLimit),
+	}
+	for _, name := range gpu.ClockEventReasons {
+		lines = append(lines, "• "+describeClockEventReason(name))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottleDetector(t *testing.T) {
+	store := testStore(t)
+	s := loadFixture(t, "555")
+	start := s.CollectedAt
+	// GPU 0 is power capped and thermally slowed down; GPU 1 is not throttled.
+	s.GPUs[1].ClockEventReasons = []string{"gpu_idle"}
+
+	observe := func(d *ThrottleDetector, after time.Duration) []Alert {
+		s.CollectedAt = start.Add(after)
+		return d.Observe(s)
+	}
+
+	d := NewThrottleDetector(10*time.Minute, false, store)
+	if alerts := observe(d, 0); len(alerts) != 0 {
+		t.Fatalf("alerted at once: %v", alerts)
+	}
+
+	// A restart keeps counting from the start of the throttling.
+	d = NewThrottleDetector(10*time.Minute, false, store)
+	alerts := observe(d, 10*time.Minute)
+	if len(alerts) != 1 {
+		t.Fatalf("expected an alert for GPU 0, got %v", alerts)
+	}
+	for _, want := range []string{"<b>ALERT</b> GPU 0", "<b>thermally and power throttled</b> for 10m0s", "SM clock 1560 MHz of 2100 MHz", "• power capped"} {
+		if !strings.Contains(alerts[0].Text, want) {
+			t.Errorf("alert does not contain %q:\n%s", want, alerts[0].Text)
+		}
+	}
+	if alerts := observe(d, 20*time.Minute); len(alerts) != 0 {
+		t.Fatalf("alert repeated: %v", alerts)
+	}
+
+	// The power cap alone counts, unless it is ignored.
+	power := loadFixture(t, "555")
+	power.GPUs[0].ClockEventReasons = []string{"sw_power_cap"}
+	power.GPUs[1].ClockEventReasons = nil
+	for ignore, want := range map[bool]int{false: 1, true: 0} {
+		powerDetector := NewThrottleDetector(10*time.Minute, ignore, testStore(t))
+		var alerts []Alert
+		for _, after := range []time.Duration{0, time.Hour} {
+			power.CollectedAt = start.Add(after)
+			alerts = append(alerts, powerDetector.Observe(power)...)
+		}
+		if len(alerts) != want || want == 1 && !strings.Contains(alerts[0].Text, "<b>power throttled</b>") {
+			t.Errorf("power cap with ignore %v: %v", ignore, alerts)
+		}
+	}
+
+	// An idle GPU is not throttling anything.
+	s.GPUs[0].GPUUtil = Reading{Value: 0}
+	alerts = observe(d, 25*time.Minute)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Text, "<b>RESOLVED</b> GPU 0 (") || !strings.Contains(alerts[0].Text, "after 25m0s") {
+		t.Fatalf("expected a resolved message, got %v", alerts)
+	}
+}
+
+func TestThrottleKinds(t *testing.T) {
+	for reasons, want := range map[string][2]bool{
+		"":                                 {false, false},
+		"gpu_idle":                         {false, false},
+		"sw_power_cap":                     {false, true},
+		"hw_power_brake_slowdown":          {false, true},
+		"hw_thermal_slowdown":              {true, false},
+		"sw_thermal_slowdown,sw_power_cap": {true, true},
+	} {
+		thermal, power := throttleKinds(GPU{ClockEventReasons: strings.Split(reasons, ",")}, false)
+		if thermal != want[0] || power != want[1] {
+			t.Errorf("%q: thermal %v, power %v, want %v", reasons, thermal, power, want)
+		}
+	}
+
+	if thermal, power := throttleKinds(GPU{ClockEventReasons: []string{"sw_thermal_slowdown", "sw_power_cap"}}, true); !thermal || power {
+		t.Errorf("ignoring the power cap: thermal %v, power %v", thermal, power)
+	}
+}
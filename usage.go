@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// usageKey identifies who used a GPU: the process name and the user running it.
+type usageKey struct {
+	Process string `json:"process"`
+	User    string `json:"user"`
+}
+
+// usageEntry is the GPU time of one key within an hour, in hours.
+type usageEntry struct {
+	usageKey
+	Hours float64 `json:"hours"`
+}
+
+// ProcessUsage accounts the time processes spend on GPUs in hourly buckets. A process on two GPUs
+// counts twice, so the totals are GPU-hours. It is an Observer fed by the poller.
+type ProcessUsage struct {
+	// interval is how often the poller samples; longer gaps, such as a restart, are not counted.
+	interval  time.Duration
+	retention time.Duration
+	procs     *ProcFS
+
+	mu    sync.Mutex
+	hours map[time.Time]map[usageKey]float64
+	last  time.Time
+	store *Store
+}
+
+// NewProcessUsage creates a ProcessUsage keeping the buckets of the last retention.
+func NewProcessUsage(interval, retention time.Duration, procs *ProcFS) *ProcessUsage {
+	return &ProcessUsage{
+		interval:  interval,
+		retention: retention,
+		procs:     procs,
+		hours:     make(map[time.Time]map[usageKey]float64),
+	}
+}
+
+// SetInterval applies a new sampling interval.
+func (u *ProcessUsage) SetInterval(interval time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.interval = interval
+}
+
+// Restore loads the buckets saved in store and keeps saving new ones there.
+func (u *ProcessUsage) Restore(store *Store, now time.Time) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.store = store
+	return store.EachUsage(now.Add(-u.retention), func(hour time.Time, entries []usageEntry) {
+		bucket := make(map[usageKey]float64, len(entries))
+		for _, e := range entries {
+			bucket[e.usageKey] = e.Hours
+		}
+		u.hours[hour] = bucket
+	})
+}
+
+func (u *ProcessUsage) Observe(s *Snapshot) []Alert {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	elapsed := s.CollectedAt.Sub(u.last)
+	first := u.last.IsZero()
+	u.last = s.CollectedAt
+	if first || elapsed <= 0 || elapsed > 2*u.interval {
+		return nil
+	}
+
+	hour := s.CollectedAt.Truncate(time.Hour)
+	bucket, ok := u.hours[hour]
+	if !ok {
+		bucket = make(map[usageKey]float64)
+		u.hours[hour] = bucket
+		u.pruneLocked(s.CollectedAt)
+	}
+
+	for _, gpu := range s.GPUs {
+		for _, process := range gpu.Processes {
+			key := usageKey{Process: filepath.Base(process.Name), User: "unknown"}
+			if info, err := u.procs.Process(process.PID, process.Name); err == nil && info.User != "" {
+				key.User = info.User
+			}
+			bucket[key] += elapsed.Hours()
+		}
+	}
+
+	if len(bucket) > 0 {
+		entries := make([]usageEntry, 0, len(bucket))
+		for key, hours := range bucket {
+			entries = append(entries, usageEntry{usageKey: key, Hours: hours})
+		}
+		if err := u.store.SaveUsage(hour, entries); err != nil {
+			log.Println("failed to save gpu usage:", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (u *ProcessUsage) pruneLocked(now time.Time) {
+	before := now.Add(-u.retention)
+	for hour := range u.hours {
+		if hour.Before(before) {
+			delete(u.hours, hour)
+		}
+	}
+	if err := u.store.PruneUsage(before); err != nil {
+		log.Println("failed to prune gpu usage:", err.Error())
+	}
+}
+
+// Totals returns the GPU-hours of every key from the hour containing since on.
+func (u *ProcessUsage) Totals(since time.Time) map[usageKey]float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	totals := make(map[usageKey]float64)
+	for hour, bucket := range u.hours {
+		if hour.Before(since.Truncate(time.Hour)) {
+			continue
+		}
+		for key, hours := range bucket {
+			totals[key] += hours
+		}
+	}
+	return totals
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// xidJournal is the xid.source that follows the kernel messages in the systemd journal.
+	xidJournal = "journal"
+	// xidPollInterval is how often a log file is checked for new lines and rotation.
+	xidPollInterval = time.Second
+	// xidRetryInterval is how long the watcher waits before it reopens a source that failed.
+	xidRetryInterval = 10 * time.Second
+	// xidRepeatInterval silences repeats of an Xid on the same GPU, which often come in floods.
+	xidRepeatInterval = 10 * time.Minute
+)
+
+// xidLinePattern matches the Xid messages of the NVIDIA driver, e.g.
+// "NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, name=python, GPU has fallen off the bus."
+var xidLinePattern = regexp.MustCompile(`NVRM: Xid \((?:PCI:)?([0-9a-fA-F]+):([0-9a-fA-F]+):([0-9a-fA-F]+)(?:\.[0-9a-fA-F]+)?\): (\d+),\s*(.*)$`)
+
+// xidProcessPattern matches the pid and name that drivers since R470 put in front of the message.
+var xidProcessPattern = regexp.MustCompile(`^pid='?([^,']*)'?, name=([^,]*), (.*)$`)
+
+// XidEvent is an Xid error reported by the driver.
+type XidEvent struct {
+	// Bus is the PCI address of the GPU as domain, bus and device, e.g. "0000:3b:00".
+	Bus     string
+	Code    int
+	PID     int
+	Process string
+	Message string
+}
+
+// parseXidLine parses an Xid message from a kernel log line.
+func parseXidLine(line string) (XidEvent, bool) {
+	m := xidLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return XidEvent{}, false
+	}
+
+	bus, ok := normalizeBusID(m[1], m[2], m[3])
+	if !ok {
+		return XidEvent{}, false
+	}
+	code, err := strconv.Atoi(m[4])
+	if err != nil {
+		return XidEvent{}, false
+	}
+
+	event := XidEvent{Bus: bus, Code: code, Message: m[5]}
+	if p := xidProcessPattern.FindStringSubmatch(m[5]); p != nil {
+		event.PID, _ = strconv.Atoi(p[1])
+		if p[2] != "<unknown>" {
+			event.Process = p[2]
+		}
+		event.Message = p[3]
+	}
+	event.Message = strings.TrimSpace(event.Message)
+
+	return event, true
+}
+
+// normalizeBusID formats a PCI domain, bus and device in hex as "dddd:bb:dd".
+func normalizeBusID(domain, bus, device string) (string, bool) {
+	d, err := strconv.ParseUint(domain, 16, 32)
+	if err != nil {
+		return "", false
+	}
+	b, err := strconv.ParseUint(bus, 16, 8)
+	if err != nil {
+		return "", false
+	}
+	dev, err := strconv.ParseUint(device, 16, 8)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%04x:%02x:%02x", d, b, dev), true
+}
+
+// gpuBusID returns the bus id of a GPU in the form of XidEvent.Bus, e.g. "0000:3b:00" for "00000000:3B:00.0".
+func gpuBusID(gpu GPU) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(gpu.ID), ":")
+	if len(parts) != 3 {
+		return "", false
+	}
+	device, _, _ := strings.Cut(parts[2], ".")
+	return normalizeBusID(parts[0], parts[1], device)
+}
+
+// xidCode explains a well-known Xid code.
+type xidCode struct {
+	description string
+	// urgent codes mean the GPU needs a reset, a reboot or a replacement.
+	urgent bool
+}
+
+var xidCodes = map[int]xidCode{
+	8:   {"GPU stopped processing: a kernel ran into a timeout, usually an application or driver problem", false},
+	13:  {"graphics engine exception: usually an application bug, such as an out of bounds access", false},
+	31:  {"GPU memory page fault: usually an application accessing an illegal address", false},
+	32:  {"invalid or corrupted push buffer stream: a driver or PCIe problem", false},
+	38:  {"driver firmware error", false},
+	43:  {"GPU stopped processing: the application hit a software fault, the GPU is fine", false},
+	45:  {"preemptive cleanup: the channel was torn down after the application exited or was killed", false},
+	48:  {"double bit ECC error: an uncorrectable memory error stopped the application; reset the GPU", true},
+	61:  {"internal micro-controller breakpoint or warning", false},
+	62:  {"internal micro-controller halt: reset the GPU", true},
+	63:  {"ECC page retirement or row remapping was recorded; it takes effect after a reset", false},
+	64:  {"ECC page retirement or row remapping failed: the GPU may need to be replaced", true},
+	68:  {"video processor exception", false},
+	69:  {"graphics engine class error: usually an application bug", false},
+	74:  {"NVLink error: check the links, the fabric and the cables", true},
+	79:  {"GPU has fallen off the bus: a hardware, power or PCIe problem; the host needs a reboot", true},
+	92:  {"high single bit ECC error rate", false},
+	94:  {"contained ECC error: only the affected application was stopped", false},
+	95:  {"uncontained ECC error: every application on the GPU was stopped; reset the GPU", true},
+	109: {"context switch timeout", false},
+	119: {"GSP firmware timed out: reset the GPU", true},
+	120: {"GSP firmware error: reset the GPU", true},
+	154: {"GPU recovery action changed: check whether the GPU must be reset or the host rebooted", true},
+}
+
+// renderXid renders the alert for an Xid event. s, if not nil, tells the GPU with the bus id; repeats is
+// how many events of the same code on the same GPU were silenced since the last alert.
+func renderXid(event XidEvent, s *Snapshot, repeats int) string {
+	target := "GPU <code>" + event.Bus + "</code>"
+	if s != nil {
+		for _, gpu := range s.GPUs {
+			if bus, ok := gpuBusID(gpu); ok && bus == event.Bus {
+				target = gpuLabel(gpu)
+				break
+			}
+		}
+	}
+
+	code, known := xidCodes[event.Code]
+	label := "<b>XID</b>"
+	if code.urgent {
+		label = "<b>URGENT</b>"
+	}
+	lines := []string{fmt.Sprintf("%s %s: Xid <b>%d</b>", label, target, event.Code)}
+	if known {
+		lines = append(lines, code.description)
+	}
+	if event.PID > 0 || event.Process != "" {
+		lines = append(lines, fmt.Sprintf("Process: <code>%d</code> %s", event.PID, html.EscapeString(event.Process)))
+	}
+	if event.Message != "" {
+		lines = append(lines, "<i>"+html.EscapeString(event.Message)+"</i>")
+	}
+	if repeats > 0 {
+		lines = append(lines, fmt.Sprintf("%d more Xid %d errors on this GPU since the last alert", repeats, event.Code))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// xidKey identifies the Xid errors of a code on a GPU.
+type xidKey struct {
+	Bus  string
+	Code int
+}
+
+// xidRepeat counts the silenced repeats of an Xid.
+type xidRepeat struct {
+	alerted time.Time
+	count   int
+}
+
+// XidWatcher follows the kernel log for Xid errors and sends an alert for each of them.
+type XidWatcher struct {
+	Send    func(Alert)
+	Collect func(context.Context) (*Snapshot, error)
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	repeats map[xidKey]*xidRepeat
+}
+
+// Apply follows source instead of the current one: a log file, "journal", or nothing when it is empty.
+func (w *XidWatcher) Apply(source string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+	if source == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go w.run(ctx, source)
+}
+
+func (w *XidWatcher) run(ctx context.Context, source string) {
+	lines := make(chan string)
+	go func() {
+		for {
+			var err error
+			if source == xidJournal {
+				err = followJournal(ctx, lines)
+			} else {
+				err = followFile(ctx, source, xidPollInterval, lines)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("failed to follow %s for Xid errors, retrying in %s: %s\n", source, xidRetryInterval, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(xidRetryInterval):
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case line := <-lines:
+			if event, ok := parseXidLine(line); ok {
+				w.handle(ctx, event, time.Now())
+			}
+		}
+	}
+}
+
+// handle alerts about an event unless the same Xid was alerted on the GPU within xidRepeatInterval.
+func (w *XidWatcher) handle(ctx context.Context, event XidEvent, now time.Time) {
+	w.mu.Lock()
+	if w.repeats == nil {
+		w.repeats = make(map[xidKey]*xidRepeat)
+	}
+	key := xidKey{event.Bus, event.Code}
+	repeat, seen := w.repeats[key]
+	if seen && now.Sub(repeat.alerted) < xidRepeatInterval {
+		repeat.count++
+		w.mu.Unlock()
+		return
+	}
+	repeats := 0
+	if seen {
+		repeats = repeat.count
+	}
+	w.repeats[key] = &xidRepeat{alerted: now}
+	w.mu.Unlock()
+
+	// nvidia-smi may fail after an Xid such as 79, in which case the GPU is named by its bus id only.
+	s, err := w.Collect(ctx)
+	if err != nil {
+		log.Println("failed to collect gpu state for an Xid alert:", err.Error())
+	}
+	w.Send(Alert{Text: renderXid(event, s, repeats)})
+}
+
+// followFile sends the lines appended to the file at path, starting at its current end. It reopens the file
+// from the start when it is rotated or truncated.
+func followFile(ctx context.Context, path string, poll time.Duration, lines chan<- string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek to the end: %w", err)
+	}
+	reader := bufio.NewReader(f)
+
+	send := func(line string) bool {
+		select {
+		case lines <- strings.TrimRight(line, "\r\n"):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+		if err == nil {
+			if !send(partial + line) {
+				return nil
+			}
+			partial = ""
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read: %w", err)
+		}
+		partial += line
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+
+		current, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat: %w", err)
+		}
+		latest, err := os.Stat(path)
+		if err != nil {
+			// The file is being rotated; the next poll reads on from the old one.
+			continue
+		}
+		rotated := !os.SameFile(current, latest)
+		if rotated || latest.Size() < offset {
+			next, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			// The lines written to the old file right before the rotation are read before switching.
+			for rotated {
+				line, err := reader.ReadString('\n')
+				partial += line
+				if err != nil {
+					break
+				}
+				if !send(partial) {
+					return nil
+				}
+				partial = ""
+			}
+			if rotated && partial != "" && !send(partial) {
+				return nil
+			}
+			f.Close()
+			f, offset, partial = next, 0, ""
+			reader.Reset(f)
+		}
+	}
+}
+
+// followJournal sends the kernel messages that journalctl prints from now on.
+func followJournal(ctx context.Context, lines chan<- string) error {
+	cmd := exec.CommandContext(ctx, "journalctl", "--dmesg", "--follow", "--lines=0", "--output=short-iso")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		select {
+		case lines <- scanner.Text():
+		case <-ctx.Done():
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("journalctl exited: %w", err)
+	}
+	return errors.New("journalctl exited")
+}
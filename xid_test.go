@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readXidFixture parses every line of a recorded kernel log in testdata/xid.
+func readXidFixture(t *testing.T, name string) []XidEvent {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", "xid", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []XidEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if event, ok := parseXidLine(scanner.Text()); ok {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestParseXidLine(t *testing.T) {
+	tests := map[string][]XidEvent{
+		"kern.log": {
+			{Bus: "0000:02:00", Code: 13, PID: 412873, Process: "python", Message: "Graphics SM Warp Exception on (GPC 2, TPC 0, SM 1): Out Of Range Address"},
+			{Bus: "0000:02:00", Code: 13, PID: 412873, Process: "python", Message: "Graphics Exception: ESR 0x514730=0x201000e 0x514734=0x24 0x514728=0xc81eb60 0x51472c=0x1174"},
+			{Bus: "0000:03:00", Code: 79, Message: "GPU has fallen off the bus."},
+			{Bus: "0000:3b:00", Code: 48, Message: "An uncorrectable double bit error (DBE) has been detected on GPU in the framebuffer at partition 6, subpartition 0."},
+			{Bus: "0000:3b:00", Code: 63, PID: 27731, Process: "python", Message: "Dynamic Page Retirement: New page retired, reboot to activate (0x00000000003f28a1)."},
+		},
+		// NVSwitch SXid lines are not GPU Xids.
+		"journal.log": {
+			{Bus: "0000:07:00", Code: 31, PID: 90211, Process: "python", Message: "Ch 00000008, intr 00000000. MMU Fault: ENGINE GRAPHICS GPCCLIENT_T1_0 faulted @ 0x7f2e_4a000000. Fault is of type FAULT_PDE ACCESS_TYPE_VIRT_READ"},
+			{Bus: "0000:0f:00", Code: 95, Message: "Uncontained: FBHUB. RST: Yes, D-RST: No"},
+			{Bus: "0000:0f:00", Code: 154, Message: "GPU recovery action changed from 0x0 (None) to 0x1 (GPU Reset Required)"},
+		},
+	}
+	for name, want := range tests {
+		if got := readXidFixture(t, name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", name, got, want)
+		}
+	}
+}
+
+func TestRenderXid(t *testing.T) {
+	events := readXidFixture(t, "kern.log")
+
+	text := renderXid(events[0], loadFixture(t, "555"), 0)
+	for _, want := range []string{"<b>XID</b> GPU 0 (", "Xid <b>13</b>", "application bug", "Process: <code>412873</code> python", "<i>Graphics SM Warp"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("alert does not contain %q:\n%s", want, text)
+		}
+	}
+
+	// nvidia-smi fails once a GPU has fallen off the bus, so the alert names the bus id.
+	text = renderXid(events[2], nil, 3)
+	for _, want := range []string{"<b>URGENT</b> GPU <code>0000:03:00</code>", "fallen off the bus", "3 more Xid 79 errors"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("alert does not contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Process:") {
+		t.Errorf("alert names an unknown process:\n%s", text)
+	}
+
+	// The V100 of the 470 fixture is on bus 3B.
+	if text := renderXid(events[3], loadFixture(t, "470"), 0); !strings.Contains(text, "<b>URGENT</b> GPU 0 (Tesla V100-PCIE-32GB") {
+		t.Errorf("legacy Xid not mapped to the GPU:\n%s", text)
+	}
+}
+
+func TestXidWatcherRepeats(t *testing.T) {
+	var alerts []Alert
+	s := loadFixture(t, "555")
+	w := &XidWatcher{
+		Send:    func(alert Alert) { alerts = append(alerts, alert) },
+		Collect: func(context.Context) (*Snapshot, error) { return s, nil },
+	}
+
+	events := readXidFixture(t, "kern.log")
+	now := time.Now()
+	w.handle(context.Background(), events[0], now)
+	w.handle(context.Background(), events[1], now.Add(time.Second))
+	w.handle(context.Background(), events[2], now.Add(time.Second))
+	if len(alerts) != 2 {
+		t.Fatalf("expected the repeated Xid 13 to be silenced, got %v", alerts)
+	}
+
+	w.handle(context.Background(), events[0], now.Add(xidRepeatInterval))
+	if len(alerts) != 3 || !strings.Contains(alerts[2].Text, "1 more Xid 13 errors") {
+		t.Fatalf("expected an alert counting the silenced Xid, got %v", alerts)
+	}
+}
+
+func TestFollowFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kern.log")
+	if err := os.WriteFile(path, []byte("old line\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() { done <- followFile(ctx, path, 5*time.Millisecond, lines) }()
+
+	next := func() string {
+		t.Helper()
+		select {
+		case line := <-lines:
+			return line
+		case err := <-done:
+			t.Fatalf("followFile returned: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no line")
+		}
+		return ""
+	}
+	appendLine := func(text string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Give followFile the time to open the file and seek to its end.
+	time.Sleep(50 * time.Millisecond)
+	appendLine("first half")
+	time.Sleep(20 * time.Millisecond)
+	appendLine(" second half\n")
+	if line := next(); line != "first half second half" {
+		t.Errorf("got %q", line)
+	}
+
+	// A rotated log is read to its end, then the new one from its start.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	old, err := os.OpenFile(path+".1", os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.WriteString("before rotation\n"); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+	appendLine("after rotation\n")
+	for _, want := range []string{"before rotation", "after rotation"} {
+		if line := next(); line != want {
+			t.Errorf("got %q, want %q", line, want)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("followFile failed: %v", err)
+	}
+}